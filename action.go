@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ActionResult 记录^Action^命令的执行情况
+type ActionResult struct {
+	Command  string        `json:"command"`
+	Output   string        `json:"output"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+}
+
+// runAction 通过系统shell执行用例指定的本地命令，代替人工操作提示。
+// 命令中的${mac}替换为被测设备的MAC地址，${tmac}和参数在解析用例时已经替换。
+// 命令超过timeout秒或done被关闭时被终止，timeout为0表示不限时
+func runAction(cli *Client, q *TestItem, timeout int, done <-chan struct{}) bool {
+	// 设备注册时已经校验MAC地址只有十六进制数字，替换到命令中是安全的
+	command := strings.Replace(q.Action, "${mac}", cli.MAC(), -1)
+	LogPrintln("[T]", L("执行动作:"), command)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	}
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	// 输出写入临时文件而不是管道，命令被终止后留下的子进程不会让Run一直等待管道关闭
+	out, err := ioutil.TempFile("", "elinks-action-")
+	if err != nil {
+		LogPrintln("[E]", L("执行动作失败:"), err)
+		return false
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	begin := time.Now()
+	err = cmd.Run()
+	output, _ := ioutil.ReadFile(out.Name())
+	q.ActionResult = &ActionResult{
+		Command:  command,
+		Output:   string(output),
+		Duration: time.Now().Sub(begin),
+	}
+	if err != nil {
+		q.ActionResult.ExitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			q.ActionResult.ExitCode = exitErr.ExitCode()
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(q.ActionResult.Output, "\r\n"), "\n") {
+		if line != "" {
+			LogPrintln("[T]", L("动作输出:"), strings.TrimRight(line, "\r"))
+		}
+	}
+	LogPrintln("[T]", fmt.Sprintf(L("动作结果: 退出码 %v，花费 %v 秒"), q.ActionResult.ExitCode, q.ActionResult.Duration.Seconds()))
+	if ctx.Err() == context.DeadlineExceeded {
+		LogPrintln("[E]", fmt.Sprintf(L("执行动作超过 %d 秒，已终止"), timeout))
+	}
+	if err != nil {
+		LogPrintln("[E]", L("执行动作失败:"), err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// 运行目录中的文件
+const (
+	checkpointParams   = "run.json"
+	checkpointResults  = "results.jsonl"
+	checkpointSnapshot = "snapshot.json"
+)
+
+// RunParams 是生成测试队列的参数，继续测试时用它重新生成同样的队列
+type RunParams struct {
+	File     string    `json:"file"`
+	TMAC     string    `json:"tmac"`
+	Tags     string    `json:"tags,omitempty"`
+	SkipTags string    `json:"skip_tags,omitempty"`
+	Run      string    `json:"run,omitempty"`
+	Skip     string    `json:"skip,omitempty"`
+	Table    string    `json:"table,omitempty"`
+	Start    time.Time `json:"start"`
+}
+
+// checkpointResult 是results.jsonl中的一行，记录一个已完成的测试
+type checkpointResult struct {
+	Index      int           `json:"index"`
+	Name       string        `json:"name"`
+	Verdict    Verdict       `json:"verdict"`
+	Result     string        `json:"result"`
+	Attempts   int           `json:"attempts"`
+	Latency    time.Duration `json:"latency"`
+	Skip       string        `json:"skip,omitempty"`
+	Finished   time.Time     `json:"finished"`
+	Transcript string        `json:"transcript"`
+
+	// 测试的消息记录，继续测试时恢复到报告中
+	Duration   time.Duration     `json:"duration"`
+	Messages   []TranscriptEntry `json:"messages,omitempty"`
+	Assertions []Assertion       `json:"assertions,omitempty"`
+	Action     *ActionResult     `json:"action,omitempty"`
+}
+
+// Checkpoint 在每个测试结束时把结果追加到运行目录，并把测试期间的日志保存为记录文件，
+// 测试程序异常退出后可以从运行目录继续，跳过已完成的测试
+type Checkpoint struct {
+	Dir string
+
+	locker     sync.Mutex
+	results    map[string]checkpointResult
+	transcript *os.File
+	logWriter  io.Writer
+}
+
+// 记录文件名中只保留这些字符
+var transcriptNameInvalid = regexp.MustCompile(`[^A-Za-z0-9._=,\[\]-]+`)
+
+func checkpointKey(index int, name string) string {
+	return fmt.Sprint(index, ":", name)
+}
+
+// CreateCheckpoint 创建运行目录并保存测试队列的参数
+func CreateCheckpoint(dir string, params RunParams) (*Checkpoint, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	b, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, checkpointParams), b, 0644); err != nil {
+		return nil, err
+	}
+	return &Checkpoint{Dir: dir, results: map[string]checkpointResult{}}, nil
+}
+
+// OpenCheckpoint 打开已有的运行目录，读取测试队列的参数和已完成的测试
+func OpenCheckpoint(dir string) (*Checkpoint, *RunParams, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, checkpointParams))
+	if err != nil {
+		return nil, nil, err
+	}
+	params := &RunParams{}
+	if err := json.Unmarshal(b, params); err != nil {
+		return nil, nil, err
+	}
+
+	c := &Checkpoint{Dir: dir, results: map[string]checkpointResult{}}
+	f, err := os.Open(filepath.Join(dir, checkpointResults))
+	if os.IsNotExist(err) {
+		return c, params, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	// 异常退出时最后一行可能不完整，忽略无法解析的行
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r checkpointResult
+		if json.Unmarshal(scanner.Bytes(), &r) == nil {
+			c.results[checkpointKey(r.Index, r.Name)] = r
+		}
+	}
+	return c, params, scanner.Err()
+}
+
+// Completed 返回已完成的测试数量
+func (c *Checkpoint) Completed() int {
+	if c == nil {
+		return 0
+	}
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return len(c.results)
+}
+
+// Restore 测试已经完成时恢复它的结果并返回true，c为nil时返回false
+func (c *Checkpoint) Restore(index int, q *TestItem) bool {
+	if c == nil {
+		return false
+	}
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	r, ok := c.results[checkpointKey(index, q.Name)]
+	if !ok {
+		return false
+	}
+	q.Verdict = r.Verdict
+	q.Attempts = r.Attempts
+	q.Latency = r.Latency
+	q.Duration = r.Duration
+	q.Transcript = r.Messages
+	q.Assertions = r.Assertions
+	q.ActionResult = r.Action
+	q.SkipReason = r.Skip
+	return true
+}
+
+// Begin 开始把日志同时写入测试的记录文件
+func (c *Checkpoint) Begin(index int, q *TestItem) {
+	if c == nil {
+		return
+	}
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	f, err := os.Create(filepath.Join(c.Dir, c.transcriptName(index, q)))
+	if err != nil {
+		LogPrintln("[E]", L("创建测试记录文件错误:"), err)
+		return
+	}
+	c.transcript = f
+	c.logWriter = SetLogOutput(io.MultiWriter(LogOutput(), f))
+}
+
+// Finish 结束记录并把测试结果追加到results.jsonl，没有结论的测试只结束记录
+func (c *Checkpoint) Finish(index int, q *TestItem) {
+	if c == nil {
+		return
+	}
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.transcript != nil {
+		SetLogOutput(c.logWriter)
+		c.transcript.Close()
+		c.transcript = nil
+	}
+	// 被停止打断的测试不保存结果，继续测试时重新执行
+	if q.Verdict == VerdictNone {
+		return
+	}
+
+	r := checkpointResult{
+		Index:      index,
+		Name:       q.Name,
+		Verdict:    q.Verdict,
+		Result:     q.Verdict.String(),
+		Attempts:   q.Attempts,
+		Latency:    q.Latency,
+		Skip:       q.SkipReason,
+		Finished:   time.Now(),
+		Transcript: c.transcriptName(index, q),
+		Duration:   q.Duration,
+		Messages:   q.Transcript,
+		Assertions: q.Assertions,
+		Action:     q.ActionResult,
+	}
+	b, err := json.Marshal(r)
+	if err == nil {
+		err = appendSync(filepath.Join(c.Dir, checkpointResults), append(b, '\n'))
+	}
+	if err != nil {
+		LogPrintln("[E]", L("保存测试结果错误:"), err)
+		return
+	}
+	c.results[checkpointKey(index, q.Name)] = r
+}
+
+func (c *Checkpoint) transcriptName(index int, q *TestItem) string {
+	return fmt.Sprintf("%03d-%s.log", index+1, transcriptNameInvalid.ReplaceAllString(q.Name, "_"))
+}
+
+// Snapshot 返回第一次测试前保存的设备配置，没有时返回nil
+func (c *Checkpoint) Snapshot() *Snapshot {
+	if c == nil {
+		return nil
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c.Dir, checkpointSnapshot))
+	if err != nil {
+		return nil
+	}
+	s := &Snapshot{}
+	if json.Unmarshal(b, s) != nil {
+		return nil
+	}
+	return s
+}
+
+// SaveSnapshot 保存测试前的设备配置，继续测试时用它恢复最初的配置
+func (c *Checkpoint) SaveSnapshot(s *Snapshot) {
+	if c == nil || s == nil {
+		return
+	}
+	b, err := json.Marshal(s)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(c.Dir, checkpointSnapshot), b, 0644)
+	}
+	if err != nil {
+		LogPrintln("[E]", L("保存设备配置错误:"), err)
+	}
+}
+
+// appendSync 追加数据并写入磁盘，测试程序异常退出时不丢失已完成的结果
+func appendSync(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"math/big"
 	"net"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,7 +26,7 @@ type Client struct {
 	conn      net.Conn
 	state     StateType
 	shareKey  []byte
-	requests  chan []byte
+	requests  chan outgoing
 	response  chan string
 	condReady *sync.Cond
 	locker    sync.Mutex
@@ -41,8 +43,56 @@ type Client struct {
 	url       string
 	wireless  string
 
+	// 测试开始时查询的设备能力，capConn是查询时的注册次数，同一次注册只查询一次
+	bandsupport string
+	workmode    string
+	networktype string
+	capConn     int
+
 	// Statistic data
 	connTimes int
+
+	// 收发消息的观察者，dir为"I"或"O"，msg为解密后的消息
+	observers []func(dir string, msg string)
+
+	// 连接状态的变化记录，用于统计断线重连
+	events []ConnEvent
+}
+
+// outgoing 是等待写入连接的消息，written不为nil时在写入后以写入时间调用
+type outgoing struct {
+	data    []byte
+	written func(t time.Time)
+}
+
+// ConnEvent 记录一次连接状态变化
+type ConnEvent struct {
+	Time  time.Time
+	State StateType
+}
+
+// 设备注册时上报的MAC地址的格式，如940E6B445754
+var devMACPattern = regexp.MustCompile(`^[0-9A-F]{12}$`)
+
+// DeviceInfo 是设备注册(dev_reg)时上报的信息
+type DeviceInfo struct {
+	MAC       string `json:"mac"`
+	Vendor    string `json:"vendor"`
+	Model     string `json:"model"`
+	SWVersion string `json:"swversion"`
+	HDVersion string `json:"hdversion"`
+	SN        string `json:"sn"`
+	IPAddr    string `json:"ipaddr"`
+	URL       string `json:"url"`
+	Wireless  string `json:"wireless"`
+
+	// 测试开始时通过get_status查询的设备能力
+	BandSupport string `json:"bandsupport,omitempty"`
+	WorkMode    string `json:"workmode,omitempty"`
+	NetworkType string `json:"networktype,omitempty"`
+
+	// 本次运行中DHCP服务器分配给设备的地址
+	Lease *DHCPLease `json:"lease,omitempty"`
 }
 
 func NewClient() Client {
@@ -50,7 +100,7 @@ func NewClient() Client {
 		conn:      nil,
 		state:     StateDisconnected,
 		shareKey:  nil,
-		requests:  make(chan []byte, 100),
+		requests:  make(chan outgoing, 100),
 		response:  make(chan string, 100),
 		condReady: sync.NewCond(&sync.Mutex{}),
 		locker:    sync.Mutex{},
@@ -98,12 +148,24 @@ func (c *Client) sendData(data []byte) (err error) {
 		if _, err = c.conn.Write(msg.Bytes()); err != nil {
 			LogPrintln("[E]", "Send error:", err)
 		} else {
-			LogPrintln("[O]", msgStr)
+			LogMessage("O", msgStr)
+			c.notify("O", msgStr)
 		}
 	}
 	return
 }
 
+// Observe 注册收发消息的观察者，需要在建立连接前调用。观察者不能阻塞
+func (c *Client) Observe(fn func(dir string, msg string)) {
+	c.observers = append(c.observers, fn)
+}
+
+func (c *Client) notify(dir string, msg string) {
+	for _, fn := range c.observers {
+		fn(dir, msg)
+	}
+}
+
 func (c *Client) sendJSON(str string) {
 	c.sendData([]byte(str))
 }
@@ -174,7 +236,7 @@ func (c *Client) onMessageDH(sequence int32, mac string, msg interface{}) {
 
 	// Set shareKey here to avoid encrypt dh message
 	c.shareKey = sharedKey.Bytes()
-	LogPrintln("[I]", "SHARE KEY:", c.shareKey)
+	LogPrintln("[-]", "SHARE KEY:", c.shareKey)
 }
 
 // {
@@ -193,6 +255,14 @@ func (c *Client) onMessageDH(sequence int32, mac string, msg interface{}) {
 //   }
 // }
 func (c *Client) onMessageDEVREG(sequence int32, mac string, msg interface{}) {
+	// MAC地址会替换到^Action^命令中，转换成940E6B445754的格式后只接受12位十六进制数字
+	reported := mac
+	mac = strings.ToUpper(strings.Replace(mac, ":", "", -1))
+	if !devMACPattern.MatchString(mac) {
+		LogPrintln("[E]", L("设备注册的MAC地址无效，拒绝注册:"), strconv.Quote(reported))
+		return
+	}
+
 	m := msg.(map[string]interface{})
 	for key, val := range m {
 		if key == "data" {
@@ -220,12 +290,13 @@ func (c *Client) onMessageDEVREG(sequence int32, mac string, msg interface{}) {
 		}
 	}
 	c.mac = mac
+	SetLogField("mac", mac)
 
 	c.sendJSON(fmt.Sprintf("{\"type\":\"ack\",\"sequence\":%d,\"mac\":\"%s\"}",
 		sequence, mac))
 
 	// The device is enrolled. the eLink connection can be used to send data.
-	c.state = StateELKConnected
+	c.setState(StateELKConnected)
 	c.condReady.Broadcast()
 	c.connTimes++
 }
@@ -287,7 +358,8 @@ func (c *Client) onMessage(data []byte) {
 
 	// Clear and show the message
 	data = bytes.Trim(data, " \t\n\r\x00")
-	LogPrintln("[I]", string(data))
+	LogMessage("I", string(data))
+	c.notify("I", string(data))
 
 	// Convert json string to object
 	var msg interface{}
@@ -332,19 +404,36 @@ func (c *Client) onMessage(data []byte) {
 		c.onMessageUnknown(int32(msgSequence), msgMAC, msg)
 	}
 
-	c.response <- string(data)
+	// 没有人读取消息时丢弃最旧的一条，避免持有锁时阻塞在通道上
+	for {
+		select {
+		case c.response <- string(data):
+			return
+		default:
+			select {
+			case <-c.response:
+			default:
+			}
+		}
+	}
 }
 
-func (c *Client) readLoop() {
+func (c *Client) readLoop(conn net.Conn) {
 	var buffer bytes.Buffer
 	var messageLength int = 0
 	for {
 		var data = make([]byte, 1024)
 		var err error
 		var receivedBytes int
-		if receivedBytes, err = c.conn.Read(data); err != nil {
+		if receivedBytes, err = conn.Read(data); err != nil {
 			LogPrintln("[E]", "Error:", err)
-			c.conn = nil
+			// 设备重连时旧连接的读协程不能清掉新连接
+			c.locker.Lock()
+			if c.conn == conn {
+				c.conn = nil
+				c.setState(StateDisconnected)
+			}
+			c.locker.Unlock()
 			break
 		}
 		buffer.Write(data[:receivedBytes])
@@ -376,7 +465,7 @@ func (c *Client) readLoop() {
 }
 
 func (c *Client) writeLoop() {
-	var message []byte = nil
+	var message *outgoing = nil
 	for {
 		if c.state != StateELKConnected {
 			time.Sleep(time.Second)
@@ -384,14 +473,19 @@ func (c *Client) writeLoop() {
 		}
 
 		if message == nil {
-			message = <-c.requests
+			m := <-c.requests
+			message = &m
 		}
 
+		// 持有locker时调用written，它总是在应答被处理之前执行
 		c.locker.Lock()
-		if err := c.sendData(message); err == nil {
+		if err := c.sendData(message.data); err == nil {
+			if message.written != nil {
+				message.written(time.Now())
+			}
 			message = nil
 		} else {
-			c.state = StateDisconnected
+			c.setState(StateDisconnected)
 		}
 		c.locker.Unlock()
 	}
@@ -400,14 +494,16 @@ func (c *Client) writeLoop() {
 func (c *Client) Run(conn net.Conn) {
 	c.locker.Lock()
 
+	// 新连接代替旧连接时也记录为一次断线
 	if c.conn != nil {
 		c.conn.Close()
+		c.setState(StateDisconnected)
 	}
 	c.conn = conn
 	c.shareKey = nil
-	c.state = StateTCPConnected
+	c.setState(StateTCPConnected)
 
-	go c.readLoop()
+	go c.readLoop(conn)
 	c.once.Do(func() {
 		go c.writeLoop()
 	})
@@ -423,12 +519,69 @@ func (c *Client) WaitReady() {
 	c.condReady.L.Unlock()
 }
 
-func (c *Client) SendRequest(msg interface{}) {
+// WaitReadyTimeout 等待设备完成注册，超时或cancel被关闭时返回false
+func (c *Client) WaitReadyTimeout(seconds int, cancel <-chan struct{}) bool {
+	ready := make(chan struct{})
+	go func() {
+		c.WaitReady()
+		close(ready)
+	}()
+
+	var timeout <-chan time.Time
+	if seconds > 0 {
+		timeout = time.After(time.Duration(seconds) * time.Second)
+	}
+	select {
+	case <-ready:
+		return true
+	case <-timeout:
+		return false
+	case <-cancel:
+		return false
+	}
+}
+
+// MAC 返回设备注册时上报的MAC地址
+func (c *Client) MAC() string {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.mac
+}
+
+// State 返回当前的连接状态
+func (c *Client) State() StateType {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.state
+}
+
+// ConnTimes 返回设备注册的次数
+func (c *Client) ConnTimes() int {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.connTimes
+}
+
+// Keyed 返回是否已经和设备协商了密钥
+func (c *Client) Keyed() bool {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.shareKey != nil
+}
+
+// Send 发送消息但不清空已收到的消息，用于连续发送多个请求
+func (c *Client) Send(msg interface{}) {
+	c.SendWritten(msg, nil)
+}
+
+// SendWritten 与Send相同，消息写入连接后以写入时间调用written，用于从实际发出的时间计算应答时间。
+// written在发送协程中调用，不能阻塞，也不能调用Client的方法
+func (c *Client) SendWritten(msg interface{}, written func(t time.Time)) {
 	// Change MAC address to real client MAC
 	m := msg.(map[string]interface{})
 	for k := range m {
 		if k == "mac" {
-			m[k] = c.mac
+			m[k] = c.MAC()
 			break
 		}
 	}
@@ -437,34 +590,128 @@ func (c *Client) SendRequest(msg interface{}) {
 	if d, err := json.Marshal(msg); err != nil {
 		LogPrintln("[E]", "Encode msg error:", err)
 	} else {
-		c.requests <- d
+		c.requests <- outgoing{data: d, written: written}
+	}
+}
+
+// Info 返回设备注册信息的副本
+func (c *Client) Info() DeviceInfo {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	return DeviceInfo{
+		MAC:       c.mac,
+		Vendor:    c.vendor,
+		Model:     c.model,
+		SWVersion: c.swversion,
+		HDVersion: c.hdversion,
+		SN:        c.sn,
+		IPAddr:    c.ipaddr,
+		URL:       c.url,
+		Wireless:  c.wireless,
+
+		BandSupport: c.bandsupport,
+		WorkMode:    c.workmode,
+		NetworkType: c.networktype,
+		Lease:       FindLease(c.mac, c.ipaddr),
+	}
+}
+
+// setCapability 保存查询到的设备能力
+func (c *Client) setCapability(name, value string) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	switch name {
+	case "bandsupport":
+		c.bandsupport = value
+	case "workmode":
+		c.workmode = value
+	case "networktype":
+		c.networktype = value
+	}
+}
+
+// needCapabilities 在本次注册还没有查询过设备能力时返回true，并记为已查询
+func (c *Client) needCapabilities() bool {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.capConn == c.connTimes {
+		return false
+	}
+	c.capConn = c.connTimes
+	return true
+}
+
+// Close 断开与设备的连接
+func (c *Client) Close() {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.setState(StateDisconnected)
+}
+
+// setState 改变连接状态并记录，调用者需要持有locker
+func (c *Client) setState(state StateType) {
+	if c.state != state {
+		c.events = append(c.events, ConnEvent{Time: time.Now(), State: state})
 	}
+	c.state = state
+}
+
+// ConnEvents 返回连接状态变化记录的副本
+func (c *Client) ConnEvents() []ConnEvent {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return append([]ConnEvent(nil), c.events...)
+}
 
-	// Drain response
+// SendRequest 清空之前收到的消息后发送请求，之后收到的消息都是发送请求以后的
+func (c *Client) SendRequest(msg interface{}) {
+	c.drainResponse()
+	c.Send(msg)
+}
+
+// drainResponse 丢弃已收到但没有被读取的消息。要在发送请求前调用，否则可能丢掉请求的应答
+func (c *Client) drainResponse() {
 	for len(c.response) > 0 {
 		<-c.response
 	}
 }
 
-func (c *Client) WaitAndCheckResponse(seconds int, keywords []string) bool {
+func (c *Client) WaitAndCheckResponse(seconds int, keywords []string, cancel <-chan struct{}) bool {
+	_, ok := c.WaitResponse(seconds, cancel, func(msg string) bool {
+		// NOTE: `matched` default as true, so if `keywords` is empty
+		// the result will be true
+		for _, v := range keywords {
+			if !strings.Contains(msg, v) {
+				return false
+			}
+		}
+		return true
+	})
+	return ok
+}
+
+// WaitResponse waits until a received message is accepted by `match`
+// and returns it, or returns false if nothing matched within `seconds`
+// or `cancel` is closed.
+func (c *Client) WaitResponse(seconds int, cancel <-chan struct{}, match func(msg string) bool) (string, bool) {
 	timeout := time.Now().Add(time.Duration(seconds) * time.Second)
 	for {
 		select {
 		case msg := <-c.response:
-			// NOTE: `matched` default as true, so if `keywords` is empty
-			// the result will be true
-			matched := true
-			for _, v := range keywords {
-				if !strings.Contains(msg, v) {
-					matched = false
-					break
-				}
-			}
-			if matched {
-				return true
+			if match(msg) {
+				return msg, true
 			}
 		case <-time.After(timeout.Sub(time.Now())):
-			return false
+			return "", false
+		case <-cancel:
+			return "", false
 		}
 	}
 }
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// 控制台命令，第一列用于Tab补全
+var consoleCommands = [][2]string{
+	{"get", "get <name>...          查询信息，如 get cpurate"},
+	{"set", "set led|wifi|wps on|off 设置开关，如 set led off"},
+	{"reboot", "reboot                 重启设备"},
+	{"rssi", "rssi <mac>             查询终端信号强度"},
+	{"deassoc", "deassoc <mac>          下挂终端去关联"},
+	{"msg", "msg <type> [json]      发送指定类型的消息，json为附加字段"},
+	{"send", "send <file.elk>        发送用例文件中的请求，并检查匹配词语"},
+	{"state", "state                  显示设备连接状态和注册信息"},
+	{"help", "help                   显示帮助"},
+	{"quit", "quit                   退出"},
+}
+
+var consoleSwitches = map[string]string{
+	"led":  "ledswitch",
+	"wifi": "wifiswitch",
+	"wps":  "wpsswitch",
+}
+
+var stateNames = map[StateType]string{
+	StateDisconnected: "未连接",
+	StateTCPConnected: "TCP已连接",
+	StateELKConnected: "e-Link已注册",
+}
+
+// 直接输入的JSON可以以这些字符开头
+const consoleJSONPrefix = "{"
+
+type Console struct {
+	cli      *Client
+	mac      string
+	sequence int
+
+	// send命令等待的匹配词语，由消息接收协程检查
+	locker   sync.Mutex
+	keywords []string
+	deadline time.Time
+}
+
+func NewConsole(cli *Client, mac string) *Console {
+	return &Console{cli: cli, mac: mac, sequence: 30000}
+}
+
+// Run 显示提示符并执行命令，直到输入quit或标准输入关闭。
+// 标准输入是终端时支持行编辑、历史记录和Tab补全
+func (c *Console) Run() {
+	go c.drainResponse()
+
+	var readLine func() (string, error)
+	if IsTerminal(os.Stdin) {
+		if state, err := term.MakeRaw(int(os.Stdin.Fd())); err == nil {
+			defer term.Restore(int(os.Stdin.Fd()), state)
+			t := term.NewTerminal(struct {
+				io.Reader
+				io.Writer
+			}{os.Stdin, os.Stdout}, "elinks> ")
+			t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+				if key != '\t' {
+					return "", 0, false
+				}
+				return c.complete(t, line, pos)
+			}
+			defer SetLogOutput(SetLogOutput(t))
+			readLine = t.ReadLine
+		}
+	}
+	if readLine == nil {
+		reader := bufio.NewReader(os.Stdin)
+		readLine = func() (string, error) {
+			line, err := reader.ReadString('\n')
+			if err != nil && line != "" {
+				err = nil
+			}
+			return line, err
+		}
+	}
+
+	LogPrintln("[T]", L("输入help查看命令，Tab补全，quit退出"))
+	for {
+		line, err := readLine()
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !c.execute(line) {
+			return
+		}
+	}
+}
+
+// drainResponse 读走所有收到的消息，避免消息通道塞满，并检查send命令的匹配词语
+func (c *Console) drainResponse() {
+	for {
+		select {
+		case msg := <-c.cli.response:
+			c.locker.Lock()
+			if c.keywords != nil {
+				matched := true
+				for _, v := range c.keywords {
+					if !strings.Contains(msg, v) {
+						matched = false
+						break
+					}
+				}
+				if matched {
+					LogPrintln("[T]", L("匹配成功:"), c.keywords)
+					c.keywords = nil
+				}
+			}
+			c.locker.Unlock()
+		case <-time.After(time.Second):
+		}
+
+		c.locker.Lock()
+		if c.keywords != nil && time.Now().After(c.deadline) {
+			LogPrintln("[T]", L("匹配超时:"), c.keywords)
+			c.keywords = nil
+		}
+		c.locker.Unlock()
+	}
+}
+
+func (c *Console) send(msg map[string]interface{}) {
+	if c.cli.State() != StateELKConnected {
+		LogPrintln("[W]", L("设备尚未注册，消息将在注册后发送"))
+	}
+	if _, ok := msg["sequence"]; !ok {
+		c.sequence++
+		msg["sequence"] = c.sequence
+	}
+	msg["mac"] = c.cli.MAC()
+	c.cli.SendRequest(msg)
+}
+
+// execute 执行一行命令，返回false表示退出
+func (c *Console) execute(line string) bool {
+	if strings.HasPrefix(line, consoleJSONPrefix) {
+		var msg map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			LogPrintln("[E]", "Convert JSON string error:", err)
+			return true
+		}
+		c.send(msg)
+		return true
+	}
+
+	args := strings.Fields(line)
+	switch args[0] {
+	case "get":
+		if len(args) < 2 {
+			return c.usage(args[0])
+		}
+		var names []interface{}
+		for _, n := range args[1:] {
+			names = append(names, map[string]interface{}{"name": n})
+		}
+		c.send(map[string]interface{}{"type": "get_status", "get": names})
+	case "set":
+		name, ok := consoleSwitches[strings.ToLower(argAt(args, 1))]
+		value := strings.ToUpper(argAt(args, 2))
+		if !ok || (value != "ON" && value != "OFF") {
+			return c.usage(args[0])
+		}
+		c.send(map[string]interface{}{"type": "cfg", "set": map[string]interface{}{
+			name: map[string]interface{}{"status": value},
+		}})
+	case "reboot":
+		c.send(map[string]interface{}{"type": "cfg", "set": map[string]interface{}{"ctrlcommand": "reboot"}})
+	case "rssi", "deassoc":
+		if len(args) < 2 {
+			return c.usage(args[0])
+		}
+		mac := strings.ToUpper(strings.Replace(args[1], ":", "", -1))
+		if args[0] == "rssi" {
+			c.send(map[string]interface{}{"type": "getrssiinfo", "get": map[string]interface{}{"mac": []string{mac}}})
+		} else {
+			c.send(map[string]interface{}{"type": "deassociation", "set": map[string]interface{}{"mac": []string{mac}}})
+		}
+	case "msg":
+		if len(args) < 2 {
+			return c.usage(args[0])
+		}
+		msg := map[string]interface{}{}
+		if body := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(line, "msg")), args[1])); body != "" {
+			if err := json.Unmarshal([]byte(body), &msg); err != nil {
+				LogPrintln("[E]", "Convert JSON string error:", err)
+				return true
+			}
+		}
+		msg["type"] = args[1]
+		c.send(msg)
+	case "send":
+		if len(args) < 2 {
+			return c.usage(args[0])
+		}
+		t := parseTestItemFile(args[1], c.mac)
+		if t == nil {
+			return true
+		}
+		item := t.build(nil)
+		m, ok := item.Request.(map[string]interface{})
+		if !ok {
+			LogPrintln("[E]", L("无效的请求:"), args[1])
+			return true
+		}
+		if len(item.ResponseKeyWord) > 0 {
+			c.locker.Lock()
+			c.keywords = item.ResponseKeyWord
+			c.deadline = time.Now().Add(time.Duration(item.RecTimeOut) * time.Second)
+			c.locker.Unlock()
+		}
+		c.send(m)
+	case "state":
+		c.showState()
+	case "help":
+		for _, v := range consoleCommands {
+			LogPrintln("[T]", L(v[1]))
+		}
+		LogPrintln("[T]", L("{...}                  直接发送JSON消息，sequence缺省时自动分配"))
+	case "quit", "exit":
+		return false
+	default:
+		LogPrintln("[E]", fmt.Sprintf(L("未知命令: %s，输入help查看命令"), args[0]))
+	}
+	return true
+}
+
+func argAt(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
+func (c *Console) usage(command string) bool {
+	for _, v := range consoleCommands {
+		if v[0] == command {
+			LogPrintln("[E]", L("用法:"), L(v[1]))
+		}
+	}
+	return true
+}
+
+func (c *Console) showState() {
+	// 设备随时可能重新注册，通过加锁的方法读取
+	info := c.cli.Info()
+	LogPrintln("[T]", L("连接状态:"), L(stateNames[c.cli.State()]))
+	LogPrintln("[T]", L("连接次数:"), c.cli.ConnTimes())
+	LogPrintln("[T]", L("已协商密钥:"), c.cli.Keyed())
+	LogPrintln("[T]", "MAC:", info.MAC)
+	LogPrintln("[T]", "vendor:", info.Vendor)
+	LogPrintln("[T]", "model:", info.Model)
+	LogPrintln("[T]", "swversion:", info.SWVersion)
+	LogPrintln("[T]", "hdversion:", info.HDVersion)
+	LogPrintln("[T]", "sn:", info.SN)
+	LogPrintln("[T]", "ipaddr:", info.IPAddr)
+	LogPrintln("[T]", "url:", info.URL)
+	LogPrintln("[T]", "wireless:", info.Wireless)
+}
+
+// complete 补全光标前的最后一个词，有多个候选时补全公共前缀并列出候选
+func (c *Console) complete(t *term.Terminal, line string, pos int) (string, int, bool) {
+	head := line[:pos]
+	words := strings.Fields(head)
+	if strings.HasSuffix(head, " ") || len(words) == 0 {
+		words = append(words, "")
+	}
+	word := words[len(words)-1]
+
+	var candidates []string
+	switch {
+	case len(words) == 1:
+		for _, v := range consoleCommands {
+			candidates = append(candidates, v[0])
+		}
+	case words[0] == "get":
+		candidates = GetStatusNames
+	case words[0] == "msg" && len(words) == 2:
+		candidates = MessageTypes
+	case words[0] == "set" && len(words) == 2:
+		for k := range consoleSwitches {
+			candidates = append(candidates, k)
+		}
+		sort.Strings(candidates)
+	case words[0] == "set" && len(words) == 3:
+		candidates = []string{"on", "off"}
+	case words[0] == "send" && len(words) == 2:
+		candidates, _ = filepath.Glob("*.elk")
+	}
+
+	var matches []string
+	for _, v := range candidates {
+		if strings.HasPrefix(v, word) {
+			matches = append(matches, v)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+
+	completed := matches[0]
+	for _, v := range matches[1:] {
+		for !strings.HasPrefix(v, completed) {
+			completed = completed[:len(completed)-1]
+		}
+	}
+	if len(matches) == 1 {
+		completed += " "
+	} else if completed == word {
+		// 终端调用回调前释放了锁，可以直接输出候选列表，输出后终端会重画提示符和当前行
+		fmt.Fprintln(t, strings.Join(matches, "  "))
+		return "", 0, false
+	}
+
+	newLine := head[:len(head)-len(word)] + completed + line[pos:]
+	return newLine, pos - len(word) + len(completed), true
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// 规范中的表和项目的覆盖状态
+const (
+	CoverageFull    = "已覆盖"
+	CoveragePartial = "部分覆盖"
+	CoverageNone    = "未覆盖"
+)
+
+// CoverageItem 是一个项目和覆盖它的测试
+type CoverageItem struct {
+	Item  string   `json:"item"`
+	Tests []string `json:"tests,omitempty"`
+}
+
+// TableCoverage 是规范中一个表的覆盖情况，Tests是接口名称中引用这个表的测试
+type TableCoverage struct {
+	Table  string         `json:"table"`
+	Title  string         `json:"title"`
+	Status string         `json:"status"`
+	Tests  []string       `json:"tests,omitempty"`
+	Items  []CoverageItem `json:"items"`
+}
+
+// Coverage 是测试队列对规范目录的覆盖矩阵
+type Coverage struct {
+	Tables []TableCoverage `json:"tables"`
+
+	// 没有测试的get_status查询名称，以及测试引用了但不在目录中的表号
+	UncoveredGetStatus []string `json:"uncovered_get_status"`
+	UnknownTables      []string `json:"unknown_tables,omitempty"`
+}
+
+// LoadSpecTables 从JSON文件读取规范目录，格式与SpecTables相同
+func LoadSpecTables(name string) ([]SpecTable, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var tables []SpecTable
+	if err := json.Unmarshal(b, &tables); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// coverageKeys 从测试的请求和应答关键词中提取覆盖的项目
+func (q *TestItem) coverageKeys() (keys []string) {
+	m, _ := q.Request.(map[string]interface{})
+	msgType, _ := m["type"].(string)
+	if msgType != "" {
+		keys = append(keys, msgType)
+	}
+	switch msgType {
+	case "get_status":
+		get, _ := m["get"].([]interface{})
+		for _, v := range get {
+			if g, ok := v.(map[string]interface{}); ok {
+				if name, ok := g["name"].(string); ok {
+					keys = append(keys, "get_status:"+name)
+				}
+			}
+		}
+	case "cfg":
+		set, _ := m["set"].(map[string]interface{})
+		for k := range set {
+			keys = append(keys, "cfg:"+k)
+		}
+	}
+
+	// 等待设备主动上报的消息，如dev_report、roaming_report
+	for _, k := range q.ResponseKeyWord {
+		for _, t := range MessageTypes {
+			if strings.Trim(k, `"`) == t {
+				keys = append(keys, t)
+			}
+		}
+	}
+	return
+}
+
+// NewCoverage 把测试队列映射到规范目录上
+func NewCoverage(queue TestQueue, spec []SpecTable) *Coverage {
+	covered := map[string][]string{}
+	referenced := map[string][]string{}
+	for _, q := range queue {
+		seen := map[string]bool{}
+		for _, k := range q.coverageKeys() {
+			if !seen[k] {
+				seen[k] = true
+				covered[k] = append(covered[k], q.Name)
+			}
+		}
+		for _, t := range q.Tables() {
+			referenced[t] = append(referenced[t], q.Name)
+		}
+	}
+
+	c := &Coverage{UncoveredGetStatus: []string{}}
+	known := map[string]bool{}
+	for _, t := range spec {
+		known[t.Table] = true
+		tc := TableCoverage{Table: t.Table, Title: t.Title, Tests: referenced[t.Table]}
+		count := 0
+		for _, item := range t.Items {
+			tc.Items = append(tc.Items, CoverageItem{Item: item, Tests: covered[item]})
+			if len(covered[item]) > 0 {
+				count++
+			}
+		}
+		switch {
+		case count > 0 && count == len(t.Items):
+			tc.Status = CoverageFull
+		case count > 0 || len(tc.Tests) > 0:
+			tc.Status = CoveragePartial
+		default:
+			tc.Status = CoverageNone
+		}
+		c.Tables = append(c.Tables, tc)
+	}
+	for _, v := range GetStatusNames {
+		if len(covered["get_status:"+v]) == 0 {
+			c.UncoveredGetStatus = append(c.UncoveredGetStatus, v)
+		}
+	}
+	for t := range referenced {
+		if !known[t] {
+			c.UnknownTables = append(c.UnknownTables, t)
+		}
+	}
+	sort.Strings(c.UnknownTables)
+	return c
+}
+
+// Count 返回每种覆盖状态的表数
+func (c *Coverage) Count(status string) int {
+	count := 0
+	for _, v := range c.Tables {
+		if v.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Summary 返回覆盖情况的统计
+func (c *Coverage) Summary() string {
+	return fmt.Sprintf(L("%s %d, %s %d, %s %d，共 %d 个表"), L(CoverageFull), c.Count(CoverageFull), L(CoveragePartial), c.Count(CoveragePartial),
+		L(CoverageNone), c.Count(CoverageNone), len(c.Tables))
+}
+
+// Missing 返回表中没有测试的项目
+func (t *TableCoverage) Missing() (items []string) {
+	for _, v := range t.Items {
+		if len(v.Tests) == 0 {
+			items = append(items, v.Item)
+		}
+	}
+	return
+}
+
+// Print 在控制台输出覆盖矩阵
+func (c *Coverage) Print() {
+	LogPrintln("[T]", "===============================================================================================")
+	LogPrintln("[T]", L("Q/CT2621-2017 规范覆盖情况"))
+	LogPrintln("[T]", "===============================================================================================")
+	LogPrintln("[T]", FW(L("表号"), 5), "|", FW(L("名称"), 18), "|", FW(L("状态"), 8), "|", FW(L("测试数"), 6), "|", L("没有测试的项目"))
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+	for i := range c.Tables {
+		t := &c.Tables[i]
+		LogPrintln("[T]", FW(t.Table, 5), "|", FWClip(L(t.Title), 18), "|", FW(L(t.Status), 8), "|", fmt.Sprintf("%6v", len(t.Tests)), "|",
+			strings.Join(t.Missing(), ", "))
+	}
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+	LogPrintln("[T]", L("没有测试的get_status名称："), strings.Join(c.UncoveredGetStatus, ", "))
+	if len(c.UnknownTables) > 0 {
+		LogPrintln("[T]", L("不在规范目录中的表号："), strings.Join(c.UnknownTables, ", "))
+	}
+	LogPrintln("[T]", L("覆盖统计："), c.Summary())
+	LogPrintln("[T]", "===============================================================================================")
+}
+
+// Save 把覆盖矩阵写入JSON文件
+func (c *Coverage) Save(name string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, b, 0644)
+}
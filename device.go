@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredhcp/coredhcp/config"
+	"github.com/coredhcp/coredhcp/handler"
+	"github.com/coredhcp/coredhcp/plugins"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// 测试开始时通过get_status查询、写入报告的设备能力：支持频段、工作模式和组网类型
+var CapabilityNames = []string{"bandsupport", "workmode", "networktype"}
+
+const capabilitySequence = 20101
+
+// statusText 把get_status应答中的值转换为报告中的文本，不是字符串的值按JSON输出
+func statusText(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// QueryCapabilities 逐项查询设备能力，查询失败的项在报告中为空。
+// 设备每次注册只查询一次，稳定性测试的每一轮不再重复查询；cancel关闭时停止查询
+func QueryCapabilities(cli *Client, cancel <-chan struct{}) {
+	if !cli.needCapabilities() {
+		return
+	}
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+	LogPrintln("[T]", L("查询设备能力"))
+	for i, name := range CapabilityNames {
+		select {
+		case <-cancel:
+			return
+		default:
+		}
+
+		sequence := capabilitySequence + i
+		cli.SendRequest(map[string]interface{}{
+			"type":     "get_status",
+			"sequence": sequence,
+			"mac":      cli.MAC(),
+			"get":      []interface{}{map[string]interface{}{"name": name}},
+		})
+
+		var value interface{}
+		_, ok := cli.WaitResponse(snapshotTimeOut, cancel, func(msg string) bool {
+			var found bool
+			value, found = parseStatusReply(msg, name)
+			return found
+		})
+		if ok {
+			cli.setCapability(name, statusText(value))
+			LogPrintln("[T]", L("设备能力:"), name, statusText(value))
+		} else {
+			LogPrintln("[W]", L("查询设备能力失败:"), name)
+		}
+	}
+}
+
+// DHCPLease 是DHCP服务器通过ACK分配给设备的地址
+type DHCPLease struct {
+	MAC       string    `json:"mac"`
+	IP        string    `json:"ip"`
+	Netmask   string    `json:"netmask,omitempty"`
+	Router    string    `json:"router,omitempty"`
+	ServerID  string    `json:"server_id,omitempty"`
+	LeaseTime int       `json:"lease_time"`
+	Time      time.Time `json:"time"`
+}
+
+func (l *DHCPLease) String() string {
+	s := l.IP
+	if l.Netmask != "" {
+		s += "/" + l.Netmask
+	}
+	if l.Router != "" {
+		s += fmt.Sprintf(L(" 网关 %s"), l.Router)
+	}
+	return s + fmt.Sprintf(L(" 租期 %d 秒，分配于 %s"), l.LeaseTime, l.Time.Format("2006-01-02 15:04:05"))
+}
+
+// 本次运行中DHCP服务器分配的地址，键是不带冒号的大写MAC地址，与dev_reg中的mac相同
+var dhcpLeases = struct {
+	sync.Mutex
+	m map[string]*DHCPLease
+}{m: map[string]*DHCPLease{}}
+
+// leaseMAC 把MAC地址转换为dev_reg中的格式，如940E6B445754
+func leaseMAC(mac string) string {
+	return strings.ToUpper(strings.NewReplacer(":", "", "-", "").Replace(mac))
+}
+
+// FindLease 按MAC地址或IP地址查找本次运行中分配给设备的地址，没有时返回nil
+func FindLease(mac, ip string) *DHCPLease {
+	dhcpLeases.Lock()
+	defer dhcpLeases.Unlock()
+
+	if l, ok := dhcpLeases.m[leaseMAC(mac)]; ok {
+		c := *l
+		return &c
+	}
+	for _, l := range dhcpLeases.m {
+		if ip != "" && l.IP == ip {
+			c := *l
+			return &c
+		}
+	}
+	return nil
+}
+
+// leasePlugin 记录DHCP服务器发出的ACK，由程序自动加载，不需要写在dhcp.yml中
+var leasePlugin = plugins.Plugin{
+	Name:   "elinks_lease",
+	Setup4: setupLease,
+}
+
+// watchLeases 包装插件的DHCPv4处理函数：file等插件处理完后返回stop，
+// 之后的插件(包括leasePlugin)看不到应答，所以在返回stop时记录最终的应答
+func watchLeases(p *plugins.Plugin) *plugins.Plugin {
+	if p.Setup4 == nil {
+		return p
+	}
+	w, setup := *p, p.Setup4
+	w.Setup4 = func(args ...string) (handler.Handler4, error) {
+		h, err := setup(args...)
+		if err != nil || h == nil {
+			return h, err
+		}
+		return func(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+			resp, stop := h(req, resp)
+			if stop {
+				recordLease(resp)
+			}
+			return resp, stop
+		}, nil
+	}
+	return &w
+}
+
+// addLeasePlugin 把leasePlugin加在DHCPv4插件的最后，记录没有插件返回stop时的应答
+func addLeasePlugin(conf *config.Config) {
+	if conf.Server4 != nil {
+		conf.Server4.Plugins = append(conf.Server4.Plugins, config.PluginConfig{Name: leasePlugin.Name})
+	}
+}
+
+func setupLease(args ...string) (handler.Handler4, error) {
+	return leaseHandler4, nil
+}
+
+func leaseHandler4(req, resp *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, bool) {
+	recordLease(resp)
+	return resp, false
+}
+
+// recordLease 记录发给设备的ACK中分配的地址
+func recordLease(resp *dhcpv4.DHCPv4) {
+	if resp == nil || resp.MessageType() != dhcpv4.MessageTypeAck || resp.YourIPAddr.IsUnspecified() {
+		return
+	}
+	l := &DHCPLease{
+		MAC:       leaseMAC(resp.ClientHWAddr.String()),
+		IP:        resp.YourIPAddr.String(),
+		LeaseTime: int(resp.IPAddressLeaseTime(0) / time.Second),
+		Time:      time.Now(),
+	}
+	if mask := resp.SubnetMask(); mask != nil {
+		l.Netmask = net.IP(mask).String()
+	}
+	if routers := resp.Router(); len(routers) > 0 {
+		l.Router = routers[0].String()
+	}
+	if id := resp.ServerIdentifier(); id != nil {
+		l.ServerID = id.String()
+	}
+
+	dhcpLeases.Lock()
+	dhcpLeases.m[l.MAC] = l
+	dhcpLeases.Unlock()
+	LogPrintln("[T]", L("DHCP分配地址:"), l.MAC, l.IP)
+}
+
+// Rows 返回报告中设备信息的各行：dev_reg上报的信息、设备能力和DHCP租约
+func (d DeviceInfo) Rows() []ReportField {
+	lease := L("无（本次运行没有为设备分配地址）")
+	if d.Lease != nil {
+		lease = d.Lease.String()
+	}
+	return []ReportField{
+		{Name: L("厂商"), Value: d.Vendor},
+		{Name: L("型号"), Value: d.Model},
+		{Name: L("MAC地址"), Value: d.MAC},
+		{Name: L("软件版本"), Value: d.SWVersion},
+		{Name: L("硬件版本"), Value: d.HDVersion},
+		{Name: L("序列号"), Value: d.SN},
+		{Name: L("IP地址"), Value: d.IPAddr},
+		{Name: "URL", Value: d.URL},
+		{Name: L("无线"), Value: d.Wireless},
+		{Name: L("支持频段"), Value: d.BandSupport},
+		{Name: L("工作模式"), Value: d.WorkMode},
+		{Name: L("组网类型"), Value: d.NetworkType},
+		{Name: L("DHCP租约"), Value: lease},
+	}
+}
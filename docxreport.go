@@ -0,0 +1,285 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Word报告由以下几个部件组成，document.xml是正文
+var docxParts = []struct {
+	Name    string
+	Content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+</Relationships>`},
+	{"word/_rels/document.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`},
+	{"word/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:docDefaults>
+<w:rPrDefault><w:rPr><w:rFonts w:ascii="Times New Roman" w:hAnsi="Times New Roman" w:eastAsia="宋体"/><w:sz w:val="21"/><w:szCs w:val="21"/><w:lang w:eastAsia="zh-CN"/></w:rPr></w:rPrDefault>
+<w:pPrDefault><w:pPr><w:spacing w:after="60"/></w:pPr></w:pPrDefault>
+</w:docDefaults>
+<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/></w:style>
+<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:before="240" w:after="480"/><w:jc w:val="center"/></w:pPr><w:rPr><w:rFonts w:eastAsia="黑体"/><w:b/><w:sz w:val="36"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/><w:basedOn w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="360" w:after="120"/><w:outlineLvl w:val="0"/></w:pPr><w:rPr><w:rFonts w:eastAsia="黑体"/><w:b/><w:sz w:val="28"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/><w:basedOn w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="240" w:after="60"/><w:outlineLvl w:val="1"/></w:pPr><w:rPr><w:rFonts w:eastAsia="黑体"/><w:b/><w:sz w:val="24"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:after="0"/></w:pPr><w:rPr><w:rFonts w:ascii="Courier New" w:hAnsi="Courier New"/><w:sz w:val="16"/></w:rPr></w:style>
+</w:styles>`},
+}
+
+// 结果表的列宽，单位为1/20磅，合计为A4纸去掉页边距的宽度
+var docxResultColumns = []int{800, 3400, 3200, 1626}
+
+// docxWriter 生成document.xml的正文
+type docxWriter struct {
+	b strings.Builder
+}
+
+func docxEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// run 输出一段文字，换行转为Word的换行
+func (w *docxWriter) run(text string, rPr string) {
+	for i, line := range strings.Split(text, "\n") {
+		w.b.WriteString("<w:r>")
+		if rPr != "" {
+			w.b.WriteString("<w:rPr>" + rPr + "</w:rPr>")
+		}
+		if i > 0 {
+			w.b.WriteString("<w:br/>")
+		}
+		w.b.WriteString(`<w:t xml:space="preserve">` + docxEscape(strings.TrimRight(line, "\r")) + "</w:t></w:r>")
+	}
+}
+
+func (w *docxWriter) paragraph(style string, text string) {
+	w.b.WriteString("<w:p>")
+	if style != "" {
+		w.b.WriteString(`<w:pPr><w:pStyle w:val="` + style + `"/></w:pPr>`)
+	}
+	w.run(text, "")
+	w.b.WriteString("</w:p>")
+}
+
+func (w *docxWriter) pageBreak() {
+	w.b.WriteString(`<w:p><w:r><w:br w:type="page"/></w:r></w:p>`)
+}
+
+func (w *docxWriter) beginTable(columns []int) {
+	w.b.WriteString(`<w:tbl><w:tblPr><w:tblW w:w="0" w:type="auto"/><w:tblBorders>`)
+	for _, side := range []string{"top", "left", "bottom", "right", "insideH", "insideV"} {
+		w.b.WriteString(`<w:` + side + ` w:val="single" w:sz="4" w:space="0" w:color="000000"/>`)
+	}
+	w.b.WriteString(`</w:tblBorders></w:tblPr><w:tblGrid>`)
+	for _, v := range columns {
+		w.b.WriteString(fmt.Sprintf(`<w:gridCol w:w="%d"/>`, v))
+	}
+	w.b.WriteString(`</w:tblGrid>`)
+}
+
+func (w *docxWriter) endTable() {
+	w.b.WriteString("</w:tbl>")
+}
+
+// cell 输出一个单元格，vMerge为restart或continue时与上下的单元格合并
+func (w *docxWriter) cell(width int, text string, vMerge string, rPr string, shade string) {
+	w.b.WriteString(fmt.Sprintf(`<w:tc><w:tcPr><w:tcW w:w="%d" w:type="dxa"/>`, width))
+	switch vMerge {
+	case "restart":
+		w.b.WriteString(`<w:vMerge w:val="restart"/>`)
+	case "continue":
+		w.b.WriteString(`<w:vMerge/>`)
+	}
+	if shade != "" {
+		w.b.WriteString(`<w:shd w:val="clear" w:color="auto" w:fill="` + shade + `"/>`)
+	}
+	w.b.WriteString(`<w:vAlign w:val="center"/></w:tcPr><w:p>`)
+	if vMerge != "continue" {
+		w.run(text, rPr)
+	}
+	w.b.WriteString("</w:p></w:tc>")
+}
+
+// infoTable 输出两列的信息表
+func (w *docxWriter) infoTable(rows [][2]string) {
+	w.beginTable([]int{2200, 6826})
+	for _, v := range rows {
+		w.b.WriteString("<w:tr>")
+		w.cell(2200, v[0], "", "<w:b/>", "F2F2F2")
+		w.cell(6826, v[1], "", "", "")
+		w.b.WriteString("</w:tr>")
+	}
+	w.endTable()
+}
+
+// docxVerdictColors 是结果表中测试结论的颜色
+var docxVerdictColors = map[Verdict]string{
+	VerdictPass:           "2B662B",
+	VerdictPassAfterRetry: "2B662B",
+	VerdictFail:           "C00000",
+	VerdictXPass:          "C00000",
+	VerdictXFail:          "7F7F7F",
+	VerdictSkip:           "7F7F7F",
+}
+
+// SaveDocxReport 把测试报告写入Word文档：封面信息、设备信息、按接口合并单元格的结果表和消息记录附录
+func SaveDocxReport(name string, cli *Client, suite *TestSuite, interrupted string) error {
+	d := newReportData(cli, suite, interrupted)
+	w := &docxWriter{}
+
+	// 封面
+	w.paragraph("Title", strings.TrimSpace(productTitle(d.Device.Vendor, d.Device.Model))+"\n"+L("e-Link自组网接口一致性测试报告"))
+	cover := [][2]string{
+		{L("测试依据"), d.Standard},
+		{L("委托单位"), d.Client},
+		{L("测试地点"), d.Location},
+		{L("测试时间"), d.Time.Format("2006-01-02 15:04:05")},
+		{L("版 本 号"), d.Version},
+		{L("测试人员"), d.Tester},
+	}
+	for _, v := range d.Fields {
+		cover = append(cover, [2]string{v.Name, v.Value})
+	}
+	cover = append(cover, [2]string{L("连接次数"), fmt.Sprint(d.ConnTimes)})
+	if d.Interrupted != "" {
+		cover = append(cover, [2]string{L("测试中断"), d.Interrupted + L("（部分结果）")})
+	}
+	cover = append(cover, [2]string{L("结果统计"), d.Summary})
+	if d.Fingerprint != "" {
+		cover = append(cover, [2]string{L("签名指纹"), d.Fingerprint})
+	}
+	w.infoTable(cover)
+
+	// 设备信息
+	w.paragraph("Heading1", L("一、设备信息"))
+	var device [][2]string
+	for _, v := range d.Device.Rows() {
+		device = append(device, [2]string{v.Name, v.Value})
+	}
+	w.infoTable(device)
+
+	// 结果表，同一接口的连续测试合并接口名称单元格
+	w.paragraph("Heading1", L("二、测试结果"))
+	w.beginTable(docxResultColumns)
+	w.b.WriteString(`<w:tr><w:trPr><w:tblHeader/></w:trPr>`)
+	for i, v := range []string{L("序号"), L("测试接口名称"), L("测试用例名称"), L("测试结果")} {
+		w.cell(docxResultColumns[i], v, "", "<w:b/>", "D9D9D9")
+	}
+	w.b.WriteString("</w:tr>")
+	for i, v := range d.Items {
+		merge := ""
+		if i > 0 && d.Items[i-1].Interface == v.Interface {
+			merge = "continue"
+		} else if i+1 < len(d.Items) && d.Items[i+1].Interface == v.Interface {
+			merge = "restart"
+		}
+		w.b.WriteString("<w:tr>")
+		w.cell(docxResultColumns[0], fmt.Sprint(v.Index), "", "", "")
+		w.cell(docxResultColumns[1], v.Interface, merge, "", "")
+		w.cell(docxResultColumns[2], v.Name, "", "", "")
+		color := ""
+		if c, ok := docxVerdictColors[v.Verdict]; ok {
+			color = `<w:color w:val="` + c + `"/>`
+		}
+		w.cell(docxResultColumns[3], v.Verdict.String(), "", color, "")
+		w.b.WriteString("</w:tr>")
+	}
+	w.endTable()
+
+	// 规范覆盖情况
+	w.paragraph("Heading1", L("三、规范覆盖情况"))
+	coverageColumns := []int{900, 2400, 1200, 900, 3626}
+	w.beginTable(coverageColumns)
+	w.b.WriteString(`<w:tr><w:trPr><w:tblHeader/></w:trPr>`)
+	for i, v := range []string{L("表号"), L("名称"), L("状态"), L("测试数"), L("没有测试的项目")} {
+		w.cell(coverageColumns[i], v, "", "<w:b/>", "D9D9D9")
+	}
+	w.b.WriteString("</w:tr>")
+	for i := range d.Coverage.Tables {
+		t := &d.Coverage.Tables[i]
+		w.b.WriteString("<w:tr>")
+		w.cell(coverageColumns[0], t.Table, "", "", "")
+		w.cell(coverageColumns[1], L(t.Title), "", "", "")
+		w.cell(coverageColumns[2], L(t.Status), "", "", "")
+		w.cell(coverageColumns[3], fmt.Sprint(len(t.Tests)), "", "", "")
+		w.cell(coverageColumns[4], strings.Join(t.Missing(), ", "), "", "", "")
+		w.b.WriteString("</w:tr>")
+	}
+	w.endTable()
+	w.paragraph("", L("没有测试的get_status名称：")+strings.Join(d.Coverage.UncoveredGetStatus, ", "))
+	w.paragraph("", L("覆盖统计：")+d.Coverage.Summary())
+
+	// 附录：每个测试最后一次执行时的消息记录
+	w.pageBreak()
+	w.paragraph("Heading1", L("附录  消息记录"))
+	for _, v := range d.Items {
+		w.paragraph("Heading2", fmt.Sprintf(L("%d. %s（%v）"), v.Index, v.Name, v.Verdict))
+		if v.SkipReason != "" {
+			w.paragraph("", L("跳过原因: ")+v.SkipReason)
+		}
+		if v.Verdict == VerdictFail || v.Verdict == VerdictXFail {
+			w.paragraph("", failureMessage(v.TestItem))
+		}
+		if v.ActionResult != nil {
+			w.paragraph("", fmt.Sprintf(L("动作: %s，退出码 %d"), v.ActionResult.Command, v.ActionResult.ExitCode))
+			if v.ActionResult.Output != "" {
+				w.paragraph("Code", strings.TrimRight(v.ActionResult.Output, "\r\n"))
+			}
+		}
+		for _, m := range v.Transcript {
+			w.paragraph("", m.Time.Format("15:04:05.000")+" "+m.Title())
+			w.paragraph("Code", indentJSON(m.Message))
+		}
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	z := zip.NewWriter(f)
+	for _, p := range docxParts {
+		if err := docxWrite(z, p.Name, p.Content); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	document := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` + w.b.String() +
+		`<w:sectPr><w:pgSz w:w="11906" w:h="16838"/><w:pgMar w:top="1440" w:right="1440" w:bottom="1440" w:left="1440" w:header="851" w:footer="992" w:gutter="0"/></w:sectPr></w:body></w:document>`
+	if err := docxWrite(z, "word/document.xml", document); err != nil {
+		f.Close()
+		return err
+	}
+	if err := z.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func docxWrite(z *zip.Writer, name string, content string) error {
+	w, err := z.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte(content))
+	return err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// TestFilter 按标签、用例名称通配符和接口表号筛选测试用例，
+// 各条件之间是“与”的关系，同一条件的多个值之间是“或”的关系
+type TestFilter struct {
+	Tags      []string
+	SkipTags  []string
+	Names     []string
+	SkipNames []string
+	Tables    []string
+}
+
+var (
+	tablePattern  = regexp.MustCompile(`表([0-9]+(?:[、,，][0-9]+)*)`)
+	numberPattern = regexp.MustCompile(`[0-9]+`)
+)
+
+// SplitList 把逗号分隔的命令行参数拆成列表，忽略空项
+func SplitList(s string) (list []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return
+}
+
+// Tables 从接口名称中提取规范的表号，
+// 如“漫游配置/终端RSSI上报(表18、19)”得到[表18 表19]
+func (item *TestItem) Tables() (tables []string) {
+	for _, m := range tablePattern.FindAllStringSubmatch(item.Interface, -1) {
+		for _, n := range numberPattern.FindAllString(m[1], -1) {
+			tables = append(tables, "表"+n)
+		}
+	}
+	return
+}
+
+func (item *TestItem) HasTag(tag string) bool {
+	for _, t := range item.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (item *TestItem) matchName(pattern string) bool {
+	if ok, _ := filepath.Match(pattern, item.Name); ok {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, filepath.Base(item.Name))
+	return ok
+}
+
+func (item *TestItem) hasTable(table string) bool {
+	if !strings.HasPrefix(table, "表") {
+		table = "表" + table
+	}
+	for _, t := range item.Tables() {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *TestFilter) Match(item *TestItem) bool {
+	if len(f.Tags) > 0 && !anyOf(f.Tags, item.HasTag) {
+		return false
+	}
+	if anyOf(f.SkipTags, item.HasTag) {
+		return false
+	}
+	if len(f.Names) > 0 && !anyOf(f.Names, item.matchName) {
+		return false
+	}
+	if anyOf(f.SkipNames, item.matchName) {
+		return false
+	}
+	if len(f.Tables) > 0 && !anyOf(f.Tables, item.hasTable) {
+		return false
+	}
+	return true
+}
+
+func anyOf(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q TestQueue) Filter(f *TestFilter) (queue TestQueue) {
+	for _, item := range q {
+		if f.Match(item) {
+			queue = append(queue, item)
+		}
+	}
+	return
+}
@@ -4,8 +4,10 @@ go 1.15
 
 require (
 	github.com/coredhcp/coredhcp v0.0.0-20210317200407-00cc6002b6c9
-	github.com/insomniacslk/dhcp v0.0.0-20210315110227-c51060810aaa // indirect
+	github.com/insomniacslk/dhcp v0.0.0-20210315110227-c51060810aaa
 	github.com/sirupsen/logrus v1.7.0
 	golang.org/x/net v0.0.0-20210119194325-5f4716e94777 // indirect
 	golang.org/x/sys v0.0.0-20210315160823-c6e025ad8005 // indirect
+	golang.org/x/term v0.0.0-20201210144234-2321bbc49cbf
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HistoryResult 是历史记录中一个测试的结果
+type HistoryResult struct {
+	Name      string        `json:"name"`
+	Interface string        `json:"interface,omitempty"`
+	Verdict   Verdict       `json:"verdict"`
+	Result    string        `json:"result"`
+	Attempts  int           `json:"attempts,omitempty"`
+	Latency   time.Duration `json:"latency,omitempty"`
+}
+
+// HistoryRecord 是一次测试的历史记录，保存在历史目录中的一个JSON文件里
+type HistoryRecord struct {
+	ID          string          `json:"id"`
+	Start       time.Time       `json:"start"`
+	End         time.Time       `json:"end"`
+	File        string          `json:"file"`
+	RunDir      string          `json:"rundir,omitempty"`
+	Device      DeviceInfo      `json:"device"`
+	ConnTimes   int             `json:"conn_times"`
+	Interrupted string          `json:"interrupted,omitempty"`
+	Results     []HistoryResult `json:"results"`
+}
+
+// 历史记录比较时测试的结果分为通过、不通过和没有执行三类
+const (
+	outcomeNone = iota
+	outcomePass
+	outcomeFail
+)
+
+// outcome 返回测试实际的结果，预期失败算不通过，意外通过算通过
+func (r HistoryResult) outcome() int {
+	switch r.Verdict {
+	case VerdictPass, VerdictPassAfterRetry, VerdictXPass:
+		return outcomePass
+	case VerdictFail, VerdictXFail:
+		return outcomeFail
+	}
+	return outcomeNone
+}
+
+// NewHistoryRecord 根据设备注册信息和测试队列的结果生成历史记录
+func NewHistoryRecord(cli *Client, suite *TestSuite, file string, start time.Time, interrupted string) *HistoryRecord {
+	h := &HistoryRecord{
+		Start:       start,
+		End:         time.Now(),
+		File:        file,
+		Device:      cli.Info(),
+		ConnTimes:   cli.ConnTimes(),
+		Interrupted: interrupted,
+	}
+	h.ID = start.Format("20060102-150405") + "-" + transcriptNameInvalid.ReplaceAllString(h.Device.Model+"-"+h.Device.SWVersion, "_")
+	for _, v := range suite.Items.Reported() {
+		h.Results = append(h.Results, HistoryResult{
+			Name:      v.Name,
+			Interface: v.Interface,
+			Verdict:   v.Verdict,
+			Result:    v.Verdict.String(),
+			Attempts:  v.Attempts,
+			Latency:   v.Latency,
+		})
+	}
+	return h
+}
+
+// Save 把历史记录保存到dir目录中
+func (h *HistoryRecord) Save(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, h.ID+".json"), b, 0644)
+}
+
+// LoadHistory 读取dir目录中的全部历史记录，按开始时间排序
+func LoadHistory(dir string) ([]*HistoryRecord, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var records []*HistoryRecord
+	for _, name := range files {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		h := &HistoryRecord{}
+		if err := json.Unmarshal(b, h); err != nil {
+			LogPrintln("[W]", L("忽略无效的历史记录:"), name, err)
+			continue
+		}
+		records = append(records, h)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Start.Before(records[j].Start) })
+	return records, nil
+}
+
+// listHistory 列出历史记录
+func listHistory(records []*HistoryRecord) {
+	fmt.Println(FW(L("开始时间"), 19), "|", FW(L("厂商"), 10), "|", FW(L("型号"), 12), "|", FW(L("软件版本"), 24), "|", L("结果统计"))
+	for _, h := range records {
+		counts := map[Verdict]int{}
+		for _, r := range h.Results {
+			counts[r.Verdict]++
+		}
+		var summary []string
+		for k := VerdictNone; k <= VerdictSkip; k++ {
+			if counts[k] > 0 {
+				summary = append(summary, fmt.Sprint(k, " ", counts[k]))
+			}
+		}
+		fmt.Println(h.Start.Local().Format("2006-01-02 15:04:05"), "|", FW(h.Device.Vendor, 10), "|", FW(h.Device.Model, 12), "|",
+			FW(h.Device.SWVersion, 24), "|", strings.Join(summary, ", "))
+	}
+	fmt.Println(fmt.Sprintf(L("共 %d 次测试"), len(records)))
+}
+
+// CompareHistory 比较同一型号两个软件版本最近一次测试的结果，并找出多次测试中结果不稳定的测试。
+// 没有指定版本时列出历史记录，返回进程退出码
+func CompareHistory(dir string, model string, versions []string) int {
+	records, err := LoadHistory(dir)
+	if err != nil {
+		LogPrintln("[E]", L("读取历史记录错误:"), err)
+		return ExitError
+	}
+	if len(versions) == 0 {
+		listHistory(records)
+		return ExitPass
+	}
+	if len(versions) != 2 {
+		LogPrintln("[E]", L("用法: compare [-model 型号] <旧版本> <新版本>"))
+		return ExitError
+	}
+
+	// 两个版本都有记录的型号
+	models := map[string]bool{}
+	for _, h := range records {
+		if (model == "" || h.Device.Model == model) && h.Device.SWVersion == versions[0] {
+			for _, g := range records {
+				if g.Device.Model == h.Device.Model && g.Device.SWVersion == versions[1] {
+					models[h.Device.Model] = true
+				}
+			}
+		}
+	}
+	if len(models) != 1 {
+		LogPrintln("[E]", fmt.Sprintf(L("没有找到唯一的型号同时有版本 %s 和 %s 的测试记录，可以用-model指定型号"), versions[0], versions[1]))
+		return ExitError
+	}
+	for m := range models {
+		model = m
+	}
+
+	// 每个版本的全部记录，最后一条是最近一次测试
+	runs := [2][]*HistoryRecord{}
+	for _, h := range records {
+		for i, v := range versions {
+			if h.Device.Model == model && h.Device.SWVersion == v && h.Interrupted == "" {
+				runs[i] = append(runs[i], h)
+			}
+		}
+	}
+	for i, v := range versions {
+		if len(runs[i]) == 0 {
+			LogPrintln("[E]", fmt.Sprintf(L("版本 %s 没有完整的测试记录"), v))
+			return ExitError
+		}
+	}
+	old, cur := runs[0][len(runs[0])-1], runs[1][len(runs[1])-1]
+
+	fmt.Println(L("型号:"), model)
+	fmt.Println(fmt.Sprintf(L("旧版本: %s，%s，共 %d 次测试"), versions[0], old.Start.Local().Format("2006-01-02 15:04:05"), len(runs[0])))
+	fmt.Println(fmt.Sprintf(L("新版本: %s，%s，共 %d 次测试"), versions[1], cur.Start.Local().Format("2006-01-02 15:04:05"), len(runs[1])))
+
+	oldResults := map[string]HistoryResult{}
+	for _, r := range old.Results {
+		oldResults[r.Name] = r
+	}
+	var regressions, fixes, added []string
+	seen := map[string]bool{}
+	for _, r := range cur.Results {
+		seen[r.Name] = true
+		o, ok := oldResults[r.Name]
+		switch {
+		case !ok:
+			added = append(added, fmt.Sprint(FW(r.Name, 40), " ", r.Result))
+		case o.outcome() == outcomePass && r.outcome() == outcomeFail:
+			regressions = append(regressions, fmt.Sprint(FW(r.Name, 40), " ", o.Result, " -> ", r.Result))
+		case o.outcome() == outcomeFail && r.outcome() == outcomePass:
+			fixes = append(fixes, fmt.Sprint(FW(r.Name, 40), " ", o.Result, " -> ", r.Result))
+		}
+	}
+	var removed []string
+	for _, r := range old.Results {
+		if !seen[r.Name] {
+			removed = append(removed, fmt.Sprint(FW(r.Name, 40), " ", r.Result))
+		}
+	}
+
+	printSection(L("回归（旧版本通过，新版本不通过）"), regressions)
+	printSection(L("修复（旧版本不通过，新版本通过）"), fixes)
+	printSection(L("新增的测试"), added)
+	printSection(L("删除的测试"), removed)
+	printSection(L("不稳定的测试"), findFlaky(append(runs[0], runs[1]...)))
+
+	if len(regressions) > 0 {
+		return ExitFail
+	}
+	return ExitPass
+}
+
+// findFlaky 找出同一软件版本的多次测试中结果不一致，或者重试后才通过的测试
+func findFlaky(records []*HistoryRecord) []string {
+	type flakyKey struct {
+		version, name string
+	}
+	type flaky struct {
+		pass, fail, retried int
+	}
+	stats := map[flakyKey]*flaky{}
+	var keys []flakyKey
+	for _, h := range records {
+		for _, r := range h.Results {
+			key := flakyKey{version: h.Device.SWVersion, name: r.Name}
+			s, ok := stats[key]
+			if !ok {
+				s = &flaky{}
+				stats[key] = s
+				keys = append(keys, key)
+			}
+			switch r.outcome() {
+			case outcomePass:
+				s.pass++
+			case outcomeFail:
+				s.fail++
+			}
+			if r.Verdict == VerdictPassAfterRetry {
+				s.retried++
+			}
+		}
+	}
+
+	var lines []string
+	for _, key := range keys {
+		s := stats[key]
+		if (s.pass > 0 && s.fail > 0) || s.retried > 0 {
+			lines = append(lines, fmt.Sprint(FW(key.name, 40), " ", FW(key.version, 24), " ", fmt.Sprintf(L("通过 %d，不通过 %d，重试后通过 %d"), s.pass, s.fail, s.retried)))
+		}
+	}
+	return lines
+}
+
+func printSection(title string, lines []string) {
+	fmt.Println("-----------------------------------------------------------------------------------------------")
+	fmt.Println(title+":", len(lines))
+	for _, v := range lines {
+		fmt.Println("  ", v)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// htmlReport 是HTML报告模板的数据，在控制台报告的数据之外增加分组的测试和各接口的通过率
+type htmlReport struct {
+	*reportData
+	Groups []*htmlGroup
+	Rates  []*htmlRate
+}
+
+// htmlGroup 是规范中一个或几个表的测试
+type htmlGroup struct {
+	Table string
+	order int
+	Tests []*htmlTest
+}
+
+type htmlTest struct {
+	Index      int
+	Name       string
+	Interface  string
+	Result     string
+	Class      string
+	Attempts   int
+	Duration   string
+	Failure    string
+	Skip       string
+	XFail      string
+	Action     *ActionResult
+	Messages   []htmlMessage
+	Assertions []Assertion
+}
+
+type htmlMessage struct {
+	Time    string
+	Title   string
+	Text    string
+	Matched bool
+}
+
+// htmlRate 是一个接口的通过率，跳过和未执行的测试不计入，预期失败的测试单独计数，也不计入
+type htmlRate struct {
+	Interface string
+	Passed    int
+	Total     int
+	XFail     int
+	Percent   int
+}
+
+// interfaceRates 按测试接口名称统计通过率，没有接口名称的测试不统计
+func interfaceRates(items TestQueue) []*htmlRate {
+	var rates []*htmlRate
+	index := map[string]*htmlRate{}
+	for _, q := range items {
+		if q.Interface == "" {
+			continue
+		}
+		rate, ok := index[q.Interface]
+		if !ok {
+			rate = &htmlRate{Interface: q.Interface}
+			index[q.Interface] = rate
+			rates = append(rates, rate)
+		}
+		switch q.Verdict {
+		case VerdictNone, VerdictSkip:
+		case VerdictXFail:
+			rate.XFail++
+		default:
+			rate.Total++
+			if q.Verdict == VerdictPass || q.Verdict == VerdictPassAfterRetry {
+				rate.Passed++
+			}
+		}
+	}
+	for _, v := range rates {
+		if v.Total > 0 {
+			v.Percent = v.Passed * 100 / v.Total
+		}
+	}
+	return rates
+}
+
+// SaveHTMLReport 把测试报告写入不依赖外部资源的HTML文件
+func SaveHTMLReport(name string, cli *Client, suite *TestSuite, interrupted string) error {
+	r := &htmlReport{reportData: newReportData(cli, suite, interrupted)}
+
+	groups := map[string]*htmlGroup{}
+	for i, q := range suite.Items.Reported() {
+		t := &htmlTest{
+			Index:      i + 1,
+			Name:       q.Name,
+			Interface:  q.Interface,
+			Result:     q.Verdict.String(),
+			Class:      q.Verdict.Class(),
+			Attempts:   q.Attempts,
+			Duration:   millis(q.Duration),
+			Skip:       q.SkipReason,
+			XFail:      q.XFail,
+			Action:     q.ActionResult,
+			Assertions: q.Assertions,
+		}
+		if q.Verdict == VerdictFail || q.Verdict == VerdictXFail {
+			t.Failure = failureMessage(q)
+		}
+		for _, v := range q.Transcript {
+			t.Messages = append(t.Messages, htmlMessage{
+				Time:    v.Time.Format("15:04:05.000"),
+				Title:   v.Title(),
+				Text:    indentJSON(v.Message),
+				Matched: v.Matched,
+			})
+		}
+
+		// 按表号分组，没有表号的测试放在最后
+		tables := q.Tables()
+		key, order := L("其他"), int(^uint(0)>>1)
+		if len(tables) > 0 {
+			key = strings.Join(tables, "、")
+			order, _ = strconv.Atoi(strings.TrimPrefix(tables[0], "表"))
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &htmlGroup{Table: key, order: order}
+			groups[key] = g
+			r.Groups = append(r.Groups, g)
+		}
+		g.Tests = append(g.Tests, t)
+	}
+	sort.SliceStable(r.Groups, func(i, j int) bool { return r.Groups[i].order < r.Groups[j].order })
+	r.Rates = interfaceRates(suite.Items.Reported())
+
+	var b bytes.Buffer
+	if err := Report.html.Execute(&b, r); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, b.Bytes(), 0644)
+}
+
+// indentJSON 格式化JSON消息，不是JSON时原样返回
+func indentJSON(s string) string {
+	var b bytes.Buffer
+	if json.Indent(&b, []byte(s), "", "  ") != nil {
+		return s
+	}
+	return b.String()
+}
+
+// 内置的HTML报告模板
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap(reportFuncs)).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{product .Device.Vendor .Device.Model}}{{L "e-Link自组网接口一致性测试报告"}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; text-align: center; }
+h2 { font-size: 1.2em; margin-top: 1.5em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+table.info td:first-child { width: 8em; background: #f8f8f8; }
+.pass, .retried { background: #dff0d8; color: #2b662b; }
+.fail, .xpass { background: #f2dede; color: #a94442; }
+.xfail, .skip, .none { background: #eee; color: #777; }
+.已覆盖 { background: #dff0d8; }
+.部分覆盖 { background: #fcf8e3; }
+.未覆盖 { background: #f2dede; }
+.interrupted { color: #a94442; font-weight: bold; }
+summary { cursor: pointer; }
+details { margin: 4px 0; }
+pre { background: #f6f6f6; padding: 6px; margin: 4px 0; white-space: pre-wrap; word-break: break-all; font-size: 12px; }
+.bar { background: #f2dede; height: 1.2em; width: 20em; }
+.bar div { background: #5cb85c; height: 100%; }
+.matched { color: #2b662b; }
+.unmatched { color: #a94442; }
+</style>
+</head>
+<body>
+<h1>{{product .Device.Vendor .Device.Model}}{{L "e-Link自组网接口一致性测试报告"}}</h1>
+<table class="info">
+<tr><td>{{L "测试依据"}}</td><td>{{.Standard}}</td></tr>
+<tr><td>{{L "委托单位"}}</td><td>{{.Client}}</td></tr>
+<tr><td>{{L "测试地点"}}</td><td>{{.Location}}</td></tr>
+<tr><td>{{L "测试时间"}}</td><td>{{.Time.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><td>{{L "版 本 号"}}</td><td>{{.Version}}</td></tr>
+<tr><td>{{L "测试人员"}}</td><td>{{.Tester}}</td></tr>
+{{range .Fields}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}<tr><td>{{L "连接次数"}}</td><td>{{.ConnTimes}}</td></tr>
+{{if .Interrupted}}<tr><td>{{L "测试中断"}}</td><td class="interrupted">{{.Interrupted}}{{L "（部分结果）"}}</td></tr>{{end}}
+<tr><td>{{L "结果统计"}}</td><td>{{.Summary}}</td></tr>
+{{if .Fingerprint}}<tr><td>{{L "签名指纹"}}</td><td>{{.Fingerprint}}</td></tr>{{end}}
+</table>
+
+<h2>{{L "设备信息"}}</h2>
+<table class="info">
+{{range .Device.Rows}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+
+<h2>{{L "各接口通过率"}}</h2>
+<table>
+<tr><th>{{L "测试接口名称"}}</th><th>{{L "通过率"}}</th><th>{{L "通过/执行"}}</th></tr>
+{{range .Rates}}<tr><td>{{.Interface}}</td><td><div class="bar"><div style="width: {{.Percent}}%"></div></div></td><td>{{.Passed}} / {{.Total}}{{if .XFail}}{{printf (L "，预期失败 %d") .XFail}}{{end}}</td></tr>
+{{end}}</table>
+
+<h2>{{L "规范覆盖情况"}}</h2>
+<table>
+<tr><th>{{L "表号"}}</th><th>{{L "名称"}}</th><th>{{L "状态"}}</th><th>{{L "测试数"}}</th><th>{{L "没有测试的项目"}}</th></tr>
+{{range .Coverage.Tables}}<tr><td>{{.Table}}</td><td>{{L .Title}}</td><td class="{{.Status}}">{{L .Status}}</td><td>{{len .Tests}}</td><td>{{range $i, $v := .Missing}}{{if $i}}, {{end}}{{$v}}{{end}}</td></tr>
+{{end}}<tr><td colspan="5">{{L "没有测试的get_status名称："}}{{range $i, $v := .Coverage.UncoveredGetStatus}}{{if $i}}, {{end}}{{$v}}{{end}}</td></tr>
+<tr><td colspan="5">{{L "覆盖统计："}}{{.Coverage.Summary}}</td></tr>
+</table>
+
+<h2>{{L "测试结果"}}</h2>
+<table>
+<tr><th>{{L "序号"}}</th><th>{{L "测试接口名称"}}</th><th>{{L "测试用例名称"}}</th><th>{{L "测试结果"}}</th></tr>
+{{range .Groups}}<tr><th colspan="4">{{.Table}}</th></tr>
+{{range .Tests}}<tr>
+<td>{{.Index}}</td>
+<td>{{.Interface}}</td>
+<td><details><summary>{{.Name}}</summary>
+<div>{{printf (L "执行次数: %d，用时: %s") .Attempts .Duration}}</div>
+{{if .Skip}}<div>{{L "跳过原因: "}}{{.Skip}}</div>{{end}}
+{{if .XFail}}<div>{{L "预期失败: "}}{{.XFail}}</div>{{end}}
+{{if .Failure}}<div class="unmatched">{{.Failure}}</div>{{end}}
+{{if .Action}}<div>{{printf (L "动作: %s，退出码 %d") .Action.Command .Action.ExitCode}}</div>{{if .Action.Output}}<pre>{{.Action.Output}}</pre>{{end}}{{end}}
+{{range .Assertions}}<div class="{{if .Matched}}matched{{else}}unmatched{{end}}">{{L "关键词 "}}{{.Keyword}}: {{if .Matched}}{{L "已匹配"}}{{else}}{{L "未匹配"}}{{end}}</div>{{end}}
+{{range .Messages}}<div{{if .Matched}} class="matched"{{end}}>{{.Time}} {{.Title}}</div><pre>{{.Text}}</pre>{{end}}
+</details></td>
+<td class="{{.Class}}">{{.Result}}</td>
+</tr>
+{{end}}{{end}}</table>
+</body>
+</html>
+`))
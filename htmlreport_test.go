@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestInterfaceRates(t *testing.T) {
+	item := func(iface string, v Verdict) *TestItem {
+		return &TestItem{Interface: iface, Verdict: v}
+	}
+	tests := []struct {
+		name  string
+		items TestQueue
+		want  []htmlRate
+	}{
+		{name: "empty"},
+		{name: "pass and fail", items: TestQueue{
+			item("查询信息", VerdictPass),
+			item("查询信息", VerdictFail),
+			item("查询信息", VerdictPassAfterRetry),
+			item("配置信息", VerdictFail),
+		}, want: []htmlRate{
+			{Interface: "查询信息", Passed: 2, Total: 3, Percent: 66},
+			{Interface: "配置信息", Total: 1},
+		}},
+		{name: "xfail counted separately", items: TestQueue{
+			item("查询信息", VerdictPass),
+			item("查询信息", VerdictXFail),
+			item("配置信息", VerdictXFail),
+		}, want: []htmlRate{
+			{Interface: "查询信息", Passed: 1, Total: 1, XFail: 1, Percent: 100},
+			{Interface: "配置信息", XFail: 1},
+		}},
+		{name: "skipped and not run", items: TestQueue{
+			item("查询信息", VerdictSkip),
+			item("查询信息", VerdictNone),
+			item("查询信息", VerdictPass),
+		}, want: []htmlRate{
+			{Interface: "查询信息", Passed: 1, Total: 1, Percent: 100},
+		}},
+		{name: "no interface", items: TestQueue{
+			item("", VerdictFail),
+			item("", VerdictPass),
+			item("查询信息", VerdictPass),
+		}, want: []htmlRate{
+			{Interface: "查询信息", Passed: 1, Total: 1, Percent: 100},
+		}},
+	}
+	for _, tt := range tests {
+		got := interfaceRates(tt.items)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d rates, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			if *got[i] != w {
+				t.Errorf("%s: rate %d = %+v, want %+v", tt.name, i, *got[i], w)
+			}
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPServer 提供HTTP控制接口和网页仪表盘，用于在无显示器的测试台上远程操作
+type HTTPServer struct {
+	cli  *Client
+	mac  string
+	opts RunOptions
+
+	// 访问令牌，每个请求都要在Authorization: Bearer头或token参数中带上
+	token string
+
+	// 当前或最近一次执行的测试队列
+	locker   sync.Mutex
+	runner   *Runner
+	suite    *TestSuite
+	running  bool
+	finished chan struct{}
+	sequence int
+
+	// 收发消息的订阅者
+	subLocker   sync.Mutex
+	subscribers map[chan trafficEvent]struct{}
+}
+
+type trafficEvent struct {
+	Time string `json:"time"`
+	Dir  string `json:"dir"`
+	Msg  string `json:"msg"`
+}
+
+type itemStatus struct {
+	Interface string   `json:"interface"`
+	Name      string   `json:"name"`
+	Tags      []string `json:"tags,omitempty"`
+	Verdict   string   `json:"verdict"`
+	Class     string   `json:"class"`
+	Current   bool     `json:"current,omitempty"`
+}
+
+type serverStatus struct {
+	State       string       `json:"state"`
+	ConnTimes   int          `json:"conn_times"`
+	Device      DeviceInfo   `json:"device"`
+	Running     bool         `json:"running"`
+	Interrupted string       `json:"interrupted,omitempty"`
+	Prompt      string       `json:"prompt,omitempty"`
+	Summary     string       `json:"summary,omitempty"`
+	Items       []itemStatus `json:"items"`
+}
+
+// runRequest是POST /api/run的参数，字段含义与同名命令行参数相同
+type runRequest struct {
+	File     string `json:"file"`
+	Tags     string `json:"tags"`
+	SkipTags string `json:"skip_tags"`
+	Run      string `json:"run"`
+	Skip     string `json:"skip"`
+	Table    string `json:"table"`
+}
+
+// NewHTTPServer 创建HTTP控制接口，需要在设备连接前调用以便观察收发的消息。
+// token为空时随机生成一个
+func NewHTTPServer(cli *Client, mac string, opts RunOptions, token string) *HTTPServer {
+	if token == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		token = hex.EncodeToString(b)
+	}
+	h := &HTTPServer{
+		cli:         cli,
+		mac:         mac,
+		opts:        opts,
+		token:       token,
+		sequence:    40000,
+		subscribers: make(map[chan trafficEvent]struct{}),
+	}
+	cli.Observe(h.publish)
+	return h
+}
+
+// ListenAndServe 在addr上提供服务，出错时返回。addr没有指定主机时只侦听本机回环地址
+func (h *HTTPServer) ListenAndServe(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	addr = net.JoinHostPort(host, port)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", h.handleIndex)
+	mux.HandleFunc("/api/status", h.handleStatus)
+	mux.HandleFunc("/api/traffic", h.handleTraffic)
+	mux.HandleFunc("/api/run", h.handleRun)
+	mux.HandleFunc("/api/stop", h.handleStop)
+	mux.HandleFunc("/api/send", h.handleSend)
+	mux.HandleFunc("/api/confirm", h.handleConfirm)
+
+	LogPrintln("[I]", L("HTTP控制接口"), "http://"+addr+"/?token="+h.token)
+	return http.ListenAndServe(addr, h.authorize(mux))
+}
+
+// authorize 检查访问令牌，POST请求还必须是application/json，防止其他网页跨域提交表单
+func (h *HTTPServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if v := r.Header.Get("Authorization"); strings.HasPrefix(v, "Bearer ") {
+			token = strings.TrimPrefix(v, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, L("缺少或错误的访问令牌"))
+			return
+		}
+		if r.Method == http.MethodPost {
+			if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t != "application/json" {
+				writeError(w, http.StatusUnsupportedMediaType, L("请求内容必须是application/json"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// queueFile 返回请求的测试队列文件，只能是测试队列目录（-file所在目录）中的相对路径
+func queueFile(name string) (string, error) {
+	if name == "" {
+		return *flagFile, nil
+	}
+	clean := filepath.Clean(name)
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", errors.New(L("测试队列文件只能是测试队列目录中的相对路径"))
+	}
+	return filepath.Join(filepath.Dir(*flagFile), clean), nil
+}
+
+// Attach 显示由命令行启动的测试队列，执行期间不能再通过HTTP启动测试
+func (h *HTTPServer) Attach(runner *Runner, suite *TestSuite) {
+	h.locker.Lock()
+	h.runner = runner
+	h.suite = suite
+	h.running = true
+	h.locker.Unlock()
+}
+
+// Stop 停止通过HTTP启动的测试，并等待它结束
+func (h *HTTPServer) Stop(reason string) {
+	h.locker.Lock()
+	runner, running, finished := h.runner, h.running, h.finished
+	h.locker.Unlock()
+
+	if running && finished != nil {
+		runner.Stop(reason)
+		<-finished
+	}
+}
+
+func (h *HTTPServer) publish(dir string, msg string) {
+	e := trafficEvent{Time: time.Now().Format("15:04:05.000"), Dir: dir, Msg: msg}
+
+	h.subLocker.Lock()
+	defer h.subLocker.Unlock()
+	for ch := range h.subscribers {
+		// 浏览器跟不上时丢弃消息，不能阻塞收发协程
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func (h *HTTPServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, Locale); err != nil {
+		LogPrintln("[E]", L("网页模板错误:"), err)
+	}
+}
+
+func (h *HTTPServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := serverStatus{
+		State:     L(stateNames[h.cli.State()]),
+		ConnTimes: h.cli.ConnTimes(),
+		Device:    h.cli.Info(),
+		Prompt:    PendingPrompt(),
+		Items:     []itemStatus{},
+	}
+
+	h.locker.Lock()
+	runner, suite := h.runner, h.suite
+	status.Running = h.running
+	h.locker.Unlock()
+
+	if runner != nil && suite != nil {
+		status.Interrupted = runner.Interrupted()
+		current := runner.Current()
+		counts := map[Verdict]int{}
+		for _, v := range suite.Items {
+			verdict := runner.Verdict(v)
+			if v.Interface != "" {
+				counts[verdict]++
+			}
+			status.Items = append(status.Items, itemStatus{
+				Interface: v.Interface,
+				Name:      v.Name,
+				Tags:      v.Tags,
+				Verdict:   verdict.String(),
+				Class:     verdict.Class(),
+				Current:   v == current,
+			})
+		}
+		for k := VerdictNone; k <= VerdictSkip; k++ {
+			if counts[k] > 0 {
+				if status.Summary != "" {
+					status.Summary += ", "
+				}
+				status.Summary += fmt.Sprint(k, " ", counts[k])
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleTraffic 以Server-Sent Events推送收发的消息
+func (h *HTTPServer) handleTraffic(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := make(chan trafficEvent, 100)
+	h.subLocker.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.subLocker.Unlock()
+	defer func() {
+		h.subLocker.Lock()
+		delete(h.subscribers, ch)
+		h.subLocker.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	for {
+		select {
+		case e := <-ch:
+			b, _ := json.Marshal(e)
+			fmt.Fprintf(w, "data: %s\n\n", b)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *HTTPServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	var req runRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	file, err := queueFile(req.File)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.File = file
+
+	suite, err := CreateTestSuiteFromFile(req.File, h.mac)
+	if suite == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprint(L("解析TestQueue错误："), err))
+		return
+	}
+	suite.Items = suite.Items.Filter(&TestFilter{
+		Tags:      SplitList(req.Tags),
+		SkipTags:  SplitList(req.SkipTags),
+		Names:     SplitList(req.Run),
+		SkipNames: SplitList(req.Skip),
+		Tables:    SplitList(req.Table),
+	})
+
+	h.locker.Lock()
+	if h.running {
+		h.locker.Unlock()
+		writeError(w, http.StatusConflict, L("测试正在执行"))
+		return
+	}
+	runner := NewRunner(h.cli, h.opts)
+	finished := make(chan struct{})
+	h.runner, h.suite, h.running, h.finished = runner, suite, true, finished
+	h.locker.Unlock()
+
+	LogPrintln("[T]", fmt.Sprintf(L("HTTP请求执行测试队列 %s，共 %d 项"), req.File, len(suite.Items)))
+	go func() {
+		defer close(finished)
+		if h.cli.WaitReadyTimeout(0, runner.Done()) {
+			runner.RunSuite(suite)
+			printReport(h.cli, suite, runner.Interrupted())
+		}
+		h.locker.Lock()
+		h.running = false
+		h.locker.Unlock()
+	}()
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"file": req.File, "count": len(suite.Items)})
+}
+
+func (h *HTTPServer) handleStop(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	h.locker.Lock()
+	runner := h.runner
+	h.locker.Unlock()
+
+	if runner == nil {
+		writeError(w, http.StatusConflict, L("没有正在执行的测试"))
+		return
+	}
+	runner.Stop(L("HTTP请求停止"))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"stopped": true})
+}
+
+// handleSend 发送一条JSON消息，sequence缺省时自动分配，mac总是替换为设备地址
+func (h *HTTPServer) handleSend(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	var msg map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, ok := msg["type"]; !ok {
+		writeError(w, http.StatusBadRequest, L("缺少type字段"))
+		return
+	}
+	if h.cli.State() != StateELKConnected {
+		writeError(w, http.StatusServiceUnavailable, L("设备尚未注册"))
+		return
+	}
+
+	// 测试执行期间发送的消息会打乱测试的请求和应答
+	h.locker.Lock()
+	if h.running {
+		h.locker.Unlock()
+		writeError(w, http.StatusConflict, L("测试正在执行，不能发送消息"))
+		return
+	}
+	if _, ok := msg["sequence"]; !ok {
+		h.sequence++
+		msg["sequence"] = h.sequence
+	}
+	h.locker.Unlock()
+	msg["mac"] = h.cli.MAC()
+	h.cli.Send(msg)
+
+	writeJSON(w, http.StatusOK, msg)
+}
+
+func (h *HTTPServer) handleConfirm(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	if !ConfirmPrompt() {
+		writeError(w, http.StatusConflict, L("没有等待确认的人工步骤"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"confirmed": true})
+}
+
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, L("只支持POST"))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]interface{}{"error": message})
+}
+
+// 网页仪表盘，轮询/api/status并订阅/api/traffic，界面文字按当前语言显示并按所在的HTML或JS上下文转义
+var dashboardTemplate = htmltemplate.Must(htmltemplate.New("dashboard").Funcs(htmltemplate.FuncMap{"L": L}).Parse(`<!DOCTYPE html>
+<html lang="{{.}}">
+<head>
+<meta charset="utf-8">
+<title>{{L "e-Link 测试台"}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+tr.current { background: #ffd; }
+.pass, .retried { color: green; }
+.fail, .xpass { color: red; }
+.xfail, .skip { color: gray; }
+#traffic { height: 20em; overflow: auto; background: #111; color: #ddd; font-family: monospace; font-size: 12px; white-space: pre-wrap; }
+#prompt { background: #fdd; padding: 0.5em; display: none; }
+section { margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<h2>{{L "e-Link 测试台"}}</h2>
+<section id="device"></section>
+<section id="prompt"><span id="promptText"></span> <button onclick="post('/api/confirm')">{{L "确认"}}</button></section>
+<section>
+  {{L "文件"}} <input id="file" placeholder="TestQueue.txt">
+  {{L "标签"}} <input id="tags" size="10">
+  {{L "名称"}} <input id="run" size="16">
+  <button onclick="run()">{{L "开始"}}</button>
+  <button onclick="post('/api/stop')">{{L "停止"}}</button>
+  <span id="summary"></span>
+</section>
+<section><table id="items"></table></section>
+<section>
+  <input id="msg" size="80" placeholder='{"type":"get_status","get":[{"name":"cpurate"}]}'>
+  <button onclick="send()">{{L "发送"}}</button>
+</section>
+<div id="traffic"></div>
+<script>
+function esc(s) { return String(s).replace(/[&<>"']/g, function(c) { return {'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;',"'":'&#39;'}[c]; }); }
+var token = new URLSearchParams(location.search).get('token') || '';
+var auth = {'Authorization': 'Bearer ' + token};
+function post(url, body) {
+  return fetch(url, {method: 'POST', headers: {'Authorization': 'Bearer ' + token, 'Content-Type': 'application/json'}, body: JSON.stringify(body || {})})
+    .then(function(r) { return r.json(); })
+    .then(function(j) { if (j.error) alert(j.error); refresh(); });
+}
+function run() {
+  var v = function(id) { return document.getElementById(id).value; };
+  var body = {tags: v('tags'), run: v('run')};
+  if (v('file')) body.file = v('file');
+  post('/api/run', body);
+}
+function send() {
+  try { post('/api/send', JSON.parse(document.getElementById('msg').value)); } catch (e) { alert(e); }
+}
+function refresh() {
+  fetch('/api/status', {headers: auth}).then(function(r) { return r.json(); }).then(function(s) {
+    var d = s.device;
+    document.getElementById('device').innerHTML = '{{L "状态: "}}<b>' + esc(s.state) + '</b>{{L " 连接次数: "}}' + s.conn_times +
+      '<br>MAC: ' + esc(d.mac) + '{{L " 厂商: "}}' + esc(d.vendor) + '{{L " 型号: "}}' + esc(d.model) +
+      '{{L " 软件版本: "}}' + esc(d.swversion) + '{{L " 硬件版本: "}}' + esc(d.hdversion) + ' SN: ' + esc(d.sn) + ' IP: ' + esc(d.ipaddr);
+    var p = document.getElementById('prompt');
+    p.style.display = s.prompt ? 'block' : 'none';
+    document.getElementById('promptText').textContent = s.prompt || '';
+    document.getElementById('summary').textContent = (s.running ? '{{L "执行中 "}}' : '') + (s.summary || '') +
+      (s.interrupted ? '{{L " 中断: "}}' + s.interrupted : '');
+    var rows = '<tr><th>{{L "序号"}}</th><th>{{L "测试接口名称"}}</th><th>{{L "测试用例名称"}}</th><th>{{L "测试结果"}}</th></tr>';
+    s.items.forEach(function(it, i) {
+      rows += '<tr' + (it.current ? ' class="current"' : '') + '><td>' + (i + 1) + '</td><td>' + esc(it.interface) +
+        '</td><td>' + esc(it.name) + '</td><td class="' + esc(it.class) + '">' + (it.current ? '{{L "执行中"}}' : esc(it.verdict)) + '</td></tr>';
+    });
+    document.getElementById('items').innerHTML = rows;
+  });
+}
+var traffic = document.getElementById('traffic');
+new EventSource('/api/traffic?token=' + encodeURIComponent(token)).onmessage = function(e) {
+  var m = JSON.parse(e.data);
+  traffic.textContent += m.time + ' [' + m.dir + '] ' + m.msg + '\n';
+  traffic.scrollTop = traffic.scrollHeight;
+};
+refresh();
+setInterval(refresh, 1000);
+</script>
+</body>
+</html>
+`))
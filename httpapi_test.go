@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDashboardEscapesMessages(t *testing.T) {
+	const locale = "test"
+	catalogs[locale] = map[string]string{
+		"确认":         `<img src=x onerror=alert(1)>`,
+		"执行中 ":       `';alert(1);'`,
+		"序号":         `</script><script>alert(1)</script>`,
+		"e-Link 测试台": `"><b>`,
+	}
+	saved := Locale
+	Locale = locale
+	defer func() {
+		Locale = saved
+		delete(catalogs, locale)
+	}()
+
+	var b bytes.Buffer
+	if err := dashboardTemplate.Execute(&b, Locale); err != nil {
+		t.Fatal(err)
+	}
+	page := b.String()
+	for _, v := range catalogs[locale] {
+		if strings.Contains(page, v) {
+			t.Errorf("dashboard contains the unescaped message %q", v)
+		}
+	}
+}
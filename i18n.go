@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 日志、提示和报告的语言
+const (
+	LocaleZH = "zh-CN"
+	LocaleEN = "en"
+)
+
+// Locale 是当前使用的语言，由ELINKS_LANG环境变量或-lang参数设置
+var Locale = LocaleZH
+
+// 各语言的消息目录，键是中文原文，中文不需要目录
+var catalogs = map[string]map[string]string{
+	LocaleEN: messagesEN,
+}
+
+// SetLocale 设置语言，可以是zh-CN、en，也可以是zh_CN.UTF-8、en_US这样的写法
+func SetLocale(name string) error {
+	lang := strings.ToLower(name)
+	switch {
+	case strings.HasPrefix(lang, "zh"):
+		Locale = LocaleZH
+	case strings.HasPrefix(lang, "en"):
+		Locale = LocaleEN
+	default:
+		return fmt.Errorf(L("不支持的语言: %s，可以是zh-CN或en"), name)
+	}
+	return nil
+}
+
+// langArg 在解析参数之前找出-lang的值，使-h输出的帮助也使用指定的语言
+func langArg(args []string) string {
+	for i, v := range args {
+		if v == "--" {
+			break
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(v, "-"), "-")
+		if name == v {
+			continue
+		}
+		if name == "lang" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, "lang=") {
+			return strings.TrimPrefix(name, "lang=")
+		}
+	}
+	return ""
+}
+
+// L 返回消息在当前语言中的文本，目录中没有的消息原样返回
+func L(msg string) string {
+	if v, ok := catalogs[Locale][msg]; ok {
+		return v
+	}
+	return msg
+}
+
+// productTitle 返回报告标题中的厂商和型号部分
+func productTitle(vendor, model string) string {
+	return fmt.Sprintf(L("%s 公司 %s 产品"), vendor, model)
+}
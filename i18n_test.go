@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestLangArg(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"-lang", "en", "-h"}, "en"},
+		{[]string{"-h", "--lang", "en"}, "en"},
+		{[]string{"-lang=en"}, "en"},
+		{[]string{"--lang=zh-CN", "-file", "q.txt"}, "zh-CN"},
+		{[]string{"-lang"}, ""},
+		{[]string{"-file", "lang"}, ""},
+		{[]string{"-language", "en"}, ""},
+		{[]string{"--", "-lang", "en"}, ""},
+	}
+	for _, tt := range tests {
+		if got := langArg(tt.args); got != tt.want {
+			t.Errorf("langArg(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
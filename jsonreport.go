@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+// JSONReport 是-report-json输出的测试报告，供仪表盘和工单脚本读取
+type JSONReport struct {
+	Title       string           `json:"title"`
+	Standard    string           `json:"standard"`
+	Client      string           `json:"client"`
+	Location    string           `json:"location"`
+	Version     string           `json:"version"`
+	Tester      string           `json:"tester"`
+	Fields      []ReportField    `json:"fields,omitempty"`
+	Start       time.Time        `json:"start"`
+	End         time.Time        `json:"end"`
+	File        string           `json:"file"`
+	RunDir      string           `json:"rundir,omitempty"`
+	Device      DeviceInfo       `json:"device"`
+	ConnTimes   int              `json:"conn_times"`
+	Interrupted string           `json:"interrupted,omitempty"`
+	Summary     map[string]int   `json:"summary"`
+	ExitCode    int              `json:"exit_code"`
+	Tests       []JSONReportTest `json:"tests"`
+	Coverage    *Coverage        `json:"coverage"`
+	Fingerprint string           `json:"fingerprint,omitempty"`
+}
+
+// JSONReportTest 是报告中一个测试的结果，Index是控制台报告中的序号，不计入报告的测试为0
+type JSONReportTest struct {
+	Index      int               `json:"index,omitempty"`
+	Name       string            `json:"name"`
+	Interface  string            `json:"interface,omitempty"`
+	Tables     []string          `json:"tables,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+	Request    interface{}       `json:"request"`
+	Keywords   []string          `json:"keywords"`
+	Timeout    int               `json:"timeout"`
+	Transcript []TranscriptEntry `json:"transcript"`
+	Assertions []Assertion       `json:"assertions"`
+	Attempts   int               `json:"attempts"`
+	Duration   time.Duration     `json:"duration"`
+	Latency    time.Duration     `json:"latency"`
+	Verdict    Verdict           `json:"verdict"`
+	Result     string            `json:"result"`
+	Skip       string            `json:"skip,omitempty"`
+	XFail      string            `json:"xfail,omitempty"`
+	Action     *ActionResult     `json:"action,omitempty"`
+}
+
+// NewJSONReport 根据设备注册信息和测试队列的结果生成JSON报告
+func NewJSONReport(cli *Client, suite *TestSuite, file string, start time.Time, interrupted string) *JSONReport {
+	r := &JSONReport{
+		Title:       L("e-Link自组网接口一致性测试报告"),
+		Standard:    Report.Standard,
+		Client:      Report.Client,
+		Location:    Report.Location,
+		Version:     Report.Version,
+		Tester:      Report.TesterName(),
+		Fields:      Report.Fields,
+		Start:       start,
+		End:         time.Now(),
+		File:        file,
+		Device:      cli.Info(),
+		ConnTimes:   cli.ConnTimes(),
+		Interrupted: interrupted,
+		Summary:     map[string]int{},
+		ExitCode:    ExitCode(suite.Items, interrupted),
+		Tests:       []JSONReportTest{},
+		Coverage:    NewCoverage(suite.Items, SpecTables),
+		Fingerprint: Signer.Fingerprint(),
+	}
+
+	count := 0
+	for _, v := range suite.Items {
+		t := JSONReportTest{
+			Name:       v.Name,
+			Interface:  v.Interface,
+			Tables:     v.Tables(),
+			Tags:       v.Tags,
+			Request:    v.Request,
+			Keywords:   v.ResponseKeyWord,
+			Timeout:    v.RecTimeOut,
+			Transcript: v.Transcript,
+			Assertions: v.Assertions,
+			Attempts:   v.Attempts,
+			Duration:   v.Duration,
+			Latency:    v.Latency,
+			Verdict:    v.Verdict,
+			Result:     v.Verdict.String(),
+			Skip:       v.SkipReason,
+			XFail:      v.XFail,
+			Action:     v.ActionResult,
+		}
+		if v.Interface != "" {
+			count++
+			t.Index = count
+			r.Summary[v.Verdict.String()]++
+		}
+		r.Tests = append(r.Tests, t)
+	}
+	return r
+}
+
+// Save 把报告写入文件
+func (r *JSONReport) Save(name string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, b, 0644)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// JUnit XML格式的测试报告，供只支持JUnit的CI系统读取。
+// 测试队列文件对应一个testsuite，每个测试对应一个testcase，classname为接口名称
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// SaveJUnitReport 把测试结果写入JUnit XML文件
+func SaveJUnitReport(name string, cli *Client, suite *TestSuite, start time.Time, interrupted string) error {
+	info := cli.Info()
+	elapsed := time.Since(start)
+	ts := junitTestSuite{
+		Name:      suite.Name,
+		Time:      junitSeconds(elapsed),
+		Timestamp: start.Format("2006-01-02T15:04:05"),
+		Properties: []junitProperty{
+			{"standard", Report.Standard},
+			{"client", Report.Client},
+			{"location", Report.Location},
+			{"version", Report.Version},
+			{"tester", Report.TesterName()},
+			{"mac", info.MAC},
+			{"vendor", info.Vendor},
+			{"model", info.Model},
+			{"swversion", info.SWVersion},
+			{"hdversion", info.HDVersion},
+			{"sn", info.SN},
+			{"ipaddr", info.IPAddr},
+			{"url", info.URL},
+			{"wireless", info.Wireless},
+			{"bandsupport", info.BandSupport},
+			{"workmode", info.WorkMode},
+			{"networktype", info.NetworkType},
+			{"conn_times", fmt.Sprint(cli.ConnTimes())},
+		},
+	}
+	for _, v := range Report.Fields {
+		ts.Properties = append(ts.Properties, junitProperty{v.Name, v.Value})
+	}
+	if info.Lease != nil {
+		ts.Properties = append(ts.Properties, junitProperty{"lease_ip", info.Lease.IP}, junitProperty{"lease_time", fmt.Sprint(info.Lease.LeaseTime)})
+	}
+	if interrupted != "" {
+		ts.Properties = append(ts.Properties, junitProperty{"interrupted", interrupted})
+	}
+
+	for _, q := range suite.Items {
+		tc := junitTestCase{
+			Name:      q.Name,
+			ClassName: q.Interface,
+			Time:      junitSeconds(q.Duration),
+		}
+		if out := q.TranscriptText(); out != "" {
+			tc.SystemOut = &junitOutput{Text: out}
+		}
+		if tc.ClassName == "" {
+			tc.ClassName = suite.Name
+		}
+		switch q.Verdict {
+		case VerdictPass, VerdictPassAfterRetry:
+		case VerdictSkip:
+			tc.Skipped = &junitMessage{Message: L("跳过: ") + q.SkipReason}
+		case VerdictNone:
+			tc.Skipped = &junitMessage{Message: L("未执行")}
+		case VerdictXFail:
+			tc.Skipped = &junitMessage{Message: L("预期失败: ") + q.XFail, Text: failureMessage(q)}
+		case VerdictXPass:
+			tc.Failure = &junitMessage{Message: L("预期失败的测试通过了: ") + q.XFail, Type: q.Verdict.String()}
+		default:
+			tc.Failure = &junitMessage{Message: failureMessage(q), Type: q.Verdict.String()}
+		}
+		if tc.Failure != nil {
+			ts.Failures++
+		}
+		if tc.Skipped != nil {
+			ts.Skipped++
+		}
+		ts.Tests++
+		ts.Cases = append(ts.Cases, tc)
+	}
+
+	report := junitTestSuites{
+		Name:     "e-Link",
+		Tests:    ts.Tests,
+		Failures: ts.Failures,
+		Skipped:  ts.Skipped,
+		Time:     ts.Time,
+		Suites:   []junitTestSuite{ts},
+	}
+	b, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, append([]byte(xml.Header), append(b, '\n')...), 0644)
+}
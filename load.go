@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 负载测试请求的起始序号，和控制台、HTTP接口的序号错开
+const loadSequenceBase = 50000
+
+// 负载期间心跳间隔超过这个时间视为心跳中断
+const loadKeepaliveGap = 60 * time.Second
+
+// 缺省的请求组合，只查询不修改设备配置
+const LoadDefaultMix = "cpurate,memoryuserate,wifiswitch,ledswitch"
+
+// LoadRequest 是负载测试中的一种请求，Weight是它在请求组合中的权重
+type LoadRequest struct {
+	Name    string
+	Request map[string]interface{}
+	TimeOut time.Duration
+	Weight  int
+}
+
+// LoadOptions 是负载测试的发送方式。Rate大于0时按固定速率发送，
+// 否则由Concurrency个发送者各自收到应答或超时后再发送下一个请求
+type LoadOptions struct {
+	Rate        float64
+	Concurrency int
+	Duration    time.Duration
+	Mix         []*LoadRequest
+}
+
+// 每秒最多发送的请求数，更快时发送队列会一直是满的
+const LoadMaxRate = 1000
+
+// Validate 检查发送速率和并发数
+func (o LoadOptions) Validate() error {
+	if math.IsNaN(o.Rate) || o.Rate < 0 || o.Rate > LoadMaxRate {
+		return fmt.Errorf(L("无效的发送速率: %v，可以是0到%d"), o.Rate, LoadMaxRate)
+	}
+	if o.Rate == 0 && o.Concurrency <= 0 {
+		return fmt.Errorf(L("-rate为0时-concurrency必须大于0，当前为%d"), o.Concurrency)
+	}
+	return nil
+}
+
+// ParseLoadMix 解析请求组合，如 "cpurate:3,LEDSwitchON.elk"。
+// 以.elk结尾的是用例文件，其他的是get_status查询的名称，冒号后是权重，缺省为1
+func ParseLoadMix(mix string, mac string) ([]*LoadRequest, error) {
+	var requests []*LoadRequest
+	for _, v := range SplitList(mix) {
+		name, weight := v, 1
+		if i := strings.LastIndex(v, ":"); i >= 0 {
+			n, err := strconv.Atoi(v[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf(L("无效的权重: %s"), v)
+			}
+			name, weight = v[:i], n
+		}
+
+		r := &LoadRequest{Name: name, Weight: weight, TimeOut: 5 * time.Second}
+		if strings.HasSuffix(strings.ToLower(name), ".elk") {
+			t := parseTestItemFile(name, mac)
+			if t == nil {
+				return nil, fmt.Errorf(L("无效的用例文件: %s"), name)
+			}
+			item := t.build(nil)
+			m, ok := item.Request.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf(L("无效的请求: %s"), name)
+			}
+			r.Request = m
+			r.TimeOut = time.Duration(item.RecTimeOut) * time.Second
+		} else {
+			r.Request = map[string]interface{}{
+				"type": "get_status",
+				"mac":  mac,
+				"get":  []interface{}{map[string]interface{}{"name": name}},
+			}
+		}
+		requests = append(requests, r)
+	}
+	if len(requests) == 0 {
+		return nil, errors.New(L("请求组合为空"))
+	}
+	return requests, nil
+}
+
+// loadStats 是一种请求或全部请求的统计
+type loadStats struct {
+	sent      int
+	received  int
+	timeouts  int
+	late      int
+	latencies []time.Duration
+}
+
+// loadPending 是等待应答的请求，sent是请求写入连接的时间，还在发送队列中时为零值
+type loadPending struct {
+	request *LoadRequest
+	sent    time.Time
+	done    chan struct{}
+}
+
+// Load 以一定的速率或并发向设备发送请求，按序号匹配应答，统计吞吐量、应答时间、
+// 超时和丢失的应答，同时检查负载下设备的心跳和主动上报
+type Load struct {
+	cli  *Client
+	opts LoadOptions
+	stop <-chan struct{}
+
+	locker   sync.Mutex
+	sequence int
+	pending  map[int]*loadPending
+	expired  map[int]*LoadRequest
+	total    loadStats
+	stats    map[*LoadRequest]*loadStats
+
+	// 负载期间收到的心跳时间和其他主动上报的次数
+	keepalives []time.Time
+	reports    map[string]int
+
+	start time.Time
+	end   time.Time
+}
+
+// NewLoad 创建负载测试，stop被关闭时提前结束
+func NewLoad(cli *Client, opts LoadOptions, stop <-chan struct{}) *Load {
+	l := &Load{
+		cli:      cli,
+		opts:     opts,
+		stop:     stop,
+		sequence: loadSequenceBase,
+		pending:  make(map[int]*loadPending),
+		expired:  make(map[int]*LoadRequest),
+		stats:    make(map[*LoadRequest]*loadStats),
+		reports:  make(map[string]int),
+	}
+	for _, r := range opts.Mix {
+		l.stats[r] = &loadStats{}
+	}
+	return l
+}
+
+// Run 执行负载测试，期间由它读取设备发来的全部消息
+func (l *Load) Run() {
+	if l.opts.Rate > 0 {
+		LogPrintln("[T]", L("负载测试:"), fmt.Sprintf(L("每秒 %v 个请求，持续 %v"), l.opts.Rate, l.opts.Duration))
+	} else {
+		LogPrintln("[T]", L("负载测试:"), fmt.Sprintf(L("并发 %v 个请求，持续 %v"), l.opts.Concurrency, l.opts.Duration))
+	}
+
+	l.start = time.Now()
+	deadline := time.After(l.opts.Duration)
+	finished := make(chan struct{})
+	go l.dispatch(finished)
+
+	if l.opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / l.opts.Rate))
+	loop:
+		for {
+			select {
+			case <-ticker.C:
+				l.send(l.pick())
+			case <-deadline:
+				break loop
+			case <-l.stop:
+				break loop
+			}
+		}
+		ticker.Stop()
+	} else {
+		var wg sync.WaitGroup
+		quit := make(chan struct{})
+		for i := 0; i < l.opts.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-quit:
+						return
+					default:
+					}
+					r := l.pick()
+					p := l.send(r)
+					select {
+					case <-p.done:
+					case <-time.After(r.TimeOut):
+					}
+				}
+			}()
+		}
+		select {
+		case <-deadline:
+		case <-l.stop:
+		}
+		close(quit)
+		wg.Wait()
+	}
+	l.end = time.Now()
+
+	// 等待已发送请求的应答，最长等待一个超时时间
+	grace := time.Now().Add(l.maxTimeOut())
+	for time.Now().Before(grace) {
+		l.locker.Lock()
+		n := len(l.pending)
+		l.locker.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	close(finished)
+
+	// 剩下没有应答的请求都算超时
+	l.locker.Lock()
+	for seq, p := range l.pending {
+		l.expire(seq, p)
+	}
+	l.locker.Unlock()
+}
+
+func (l *Load) maxTimeOut() time.Duration {
+	var max time.Duration
+	for _, r := range l.opts.Mix {
+		if r.TimeOut > max {
+			max = r.TimeOut
+		}
+	}
+	return max
+}
+
+// pick 按权重随机选择一种请求
+func (l *Load) pick() *LoadRequest {
+	total := 0
+	for _, r := range l.opts.Mix {
+		total += r.Weight
+	}
+	n := rand.Intn(total)
+	for _, r := range l.opts.Mix {
+		if n < r.Weight {
+			return r
+		}
+		n -= r.Weight
+	}
+	return l.opts.Mix[0]
+}
+
+func (l *Load) send(r *LoadRequest) *loadPending {
+	msg := make(map[string]interface{}, len(r.Request))
+	for k, v := range r.Request {
+		msg[k] = v
+	}
+	p := &loadPending{request: r, done: make(chan struct{})}
+
+	l.locker.Lock()
+	l.sequence++
+	msg["sequence"] = l.sequence
+	l.pending[l.sequence] = p
+	l.total.sent++
+	l.stats[r].sent++
+	l.locker.Unlock()
+
+	l.cli.SendWritten(msg, func(t time.Time) {
+		l.locker.Lock()
+		p.sent = t
+		l.locker.Unlock()
+	})
+	return p
+}
+
+// expire 把请求记为超时，调用者需要持有locker
+func (l *Load) expire(seq int, p *loadPending) {
+	delete(l.pending, seq)
+	l.expired[seq] = p.request
+	l.total.timeouts++
+	l.stats[p.request].timeouts++
+}
+
+// dispatch 读取设备发来的消息，按序号匹配应答，并定期检查超时的请求
+func (l *Load) dispatch(finished <-chan struct{}) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-l.cli.response:
+			l.receive(msg)
+		case now := <-ticker.C:
+			l.locker.Lock()
+			for seq, p := range l.pending {
+				if !p.sent.IsZero() && now.Sub(p.sent) > p.request.TimeOut {
+					l.expire(seq, p)
+				}
+			}
+			l.locker.Unlock()
+		case <-finished:
+			return
+		}
+	}
+}
+
+func (l *Load) receive(msg string) {
+	var m struct {
+		Type     string `json:"type"`
+		Sequence int    `json:"sequence"`
+	}
+	if err := json.Unmarshal([]byte(msg), &m); err != nil {
+		return
+	}
+	now := time.Now()
+
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	if m.Type == "keepalive" {
+		// 心跳使用设备自己的序号，不参与匹配
+		l.keepalives = append(l.keepalives, now)
+		return
+	}
+	if p, ok := l.pending[m.Sequence]; ok {
+		latency := now.Sub(p.sent)
+		delete(l.pending, m.Sequence)
+		close(p.done)
+		l.total.received++
+		l.total.latencies = append(l.total.latencies, latency)
+		s := l.stats[p.request]
+		s.received++
+		s.latencies = append(s.latencies, latency)
+		return
+	}
+	if r, ok := l.expired[m.Sequence]; ok {
+		delete(l.expired, m.Sequence)
+		l.total.late++
+		l.stats[r].late++
+		return
+	}
+
+	switch m.Type {
+	case "status", "ack", "keyngreq", "dh", "dev_reg":
+		// 其他来源的应答和重连时的握手消息
+	default:
+		l.reports[m.Type]++
+	}
+}
+
+// percentile 返回已排序的应答时间的百分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func (s *loadStats) percentiles() (p50, p95, p99 time.Duration) {
+	sorted := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return percentile(sorted, 0.50), percentile(sorted, 0.95), percentile(sorted, 0.99)
+}
+
+// keepaliveGap 返回负载期间最长的心跳间隔，包括开始到第一次心跳和最后一次心跳到结束
+func (l *Load) keepaliveGap() time.Duration {
+	var max time.Duration
+	last := l.start
+	for _, t := range append(l.keepalives, l.end) {
+		if t.Sub(last) > max {
+			max = t.Sub(last)
+		}
+		last = t
+	}
+	return max
+}
+
+// disconnects 返回负载期间设备断线的次数
+func (l *Load) disconnects() int {
+	n := 0
+	for _, e := range l.cli.ConnEvents() {
+		if e.State == StateDisconnected && !e.Time.Before(l.start) && !e.Time.After(l.end) {
+			n++
+		}
+	}
+	return n
+}
+
+// Passed 没有超时的请求，负载期间设备没有断线并且心跳没有中断时返回true
+func (l *Load) Passed() bool {
+	return l.total.timeouts == 0 && l.disconnects() == 0 && l.keepaliveOK()
+}
+
+// keepaliveOK 检查负载期间心跳是否中断，测试时间不到loadKeepaliveGap时不检查
+func (l *Load) keepaliveOK() bool {
+	if l.end.Sub(l.start) < loadKeepaliveGap {
+		return true
+	}
+	return l.keepaliveGap() < loadKeepaliveGap
+}
+
+// PrintReport 在控制台输出负载测试报告
+func (l *Load) PrintReport(interrupted string) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	elapsed := l.end.Sub(l.start)
+	LogPrintln("[T]", "===============================================================================================")
+	info := l.cli.Info()
+	LogPrintln("[T]", productTitle(info.Vendor, info.Model)+L("e-Link控制面负载测试报告"))
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+	if l.opts.Rate > 0 {
+		LogPrintln("[T]", L("发送方式："), fmt.Sprintf(L("每秒 %v 个请求"), l.opts.Rate))
+	} else {
+		LogPrintln("[T]", L("发送方式："), fmt.Sprintf(L("并发 %v 个请求"), l.opts.Concurrency))
+	}
+	LogPrintln("[T]", L("测试时长："), elapsed.Truncate(time.Millisecond))
+	if interrupted != "" {
+		LogPrintln("[T]", fmt.Sprintf(L("测试中断：%s（部分结果）"), interrupted))
+	}
+	LogPrintln("[T]", fmt.Sprintf(L("请求数量：%d，应答数量：%d"), l.total.sent, l.total.received))
+	if elapsed > 0 {
+		LogPrintln("[T]", fmt.Sprintf(L("吞 吐 量：%.1f 个/秒"), float64(l.total.received)/elapsed.Seconds()))
+	}
+	LogPrintln("[T]", fmt.Sprintf(L("超时请求：%d，其中迟到 %d，丢失 %d"), l.total.timeouts, l.total.late, l.total.timeouts-l.total.late))
+	p50, p95, p99 := l.total.percentiles()
+	LogPrintln("[T]", fmt.Sprintf(L("应答时间：p50 %s，p95 %s，p99 %s"), millis(p50), millis(p95), millis(p99)))
+	LogPrintln("[T]", "===============================================================================================")
+	LogPrintln("[T]", FW(L("请求"), 24), "|", FW(L("权重"), 4), "|", L("  发送"), "|", L("  应答"), "|", L("  超时"), "|", FW("p50", 10), "|", FW("p95", 10), "|", "p99")
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+	for _, r := range l.opts.Mix {
+		s := l.stats[r]
+		p50, p95, p99 := s.percentiles()
+		LogPrintln("[T]", FWClip(r.Name, 24), "|", fmt.Sprintf("%4v", r.Weight), "|", fmt.Sprintf("%6v", s.sent), "|",
+			fmt.Sprintf("%6v", s.received), "|", fmt.Sprintf("%6v", s.timeouts), "|",
+			FW(millis(p50), 10), "|", FW(millis(p95), 10), "|", millis(p99))
+	}
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+	LogPrintln("[T]", fmt.Sprintf(L("设备心跳：%d 次，最长间隔 %v"), len(l.keepalives), l.keepaliveGap().Truncate(time.Millisecond)))
+	for _, k := range sortedKeys(l.reports) {
+		LogPrintln("[T]", fmt.Sprintf(L("主动上报：%s %d 次"), k, l.reports[k]))
+	}
+	LogPrintln("[T]", L("断线次数："), l.disconnects())
+	if l.disconnects() > 0 {
+		LogPrintln("[T]", L("测试结论："), L("负载期间设备断线"))
+	} else if !l.keepaliveOK() {
+		LogPrintln("[T]", L("测试结论："), L("负载期间设备心跳中断"))
+	} else if l.total.timeouts > 0 {
+		LogPrintln("[T]", L("测试结论："), fmt.Sprintf(L("有 %d 个请求没有及时应答"), l.total.timeouts))
+	} else {
+		LogPrintln("[T]", L("测试结论："), L("全部请求及时应答"))
+	}
+	LogPrintln("[T]", "===============================================================================================")
+}
+
+func sortedKeys(m map[string]int) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseLoadMix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	elk := filepath.Join(dir, "LED.elk")
+	if err := ioutil.WriteFile(elk, []byte("{\"type\":\"cfg\",\"sequence\":1,\"mac\":\"mac\",\"set\":{\"ledswitch\":{\"status\":\"ON\"}}}\n^RecTimeOut^8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "Bad.elk")
+	if err := ioutil.WriteFile(bad, []byte("[1,2]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type want struct {
+		name    string
+		typ     string
+		weight  int
+		timeout time.Duration
+	}
+	tests := []struct {
+		mix  string
+		want []want
+		err  bool
+	}{
+		{mix: "cpurate", want: []want{{"cpurate", "get_status", 1, 5 * time.Second}}},
+		{mix: "cpurate:3, memoryuserate", want: []want{
+			{"cpurate", "get_status", 3, 5 * time.Second},
+			{"memoryuserate", "get_status", 1, 5 * time.Second},
+		}},
+		{mix: elk + ":2,ledswitch", want: []want{
+			{elk, "cfg", 2, 8 * time.Second},
+			{"ledswitch", "get_status", 1, 5 * time.Second},
+		}},
+		{mix: "", err: true},
+		{mix: " , ", err: true},
+		{mix: "cpurate:0", err: true},
+		{mix: "cpurate:-1", err: true},
+		{mix: "cpurate:x", err: true},
+		{mix: filepath.Join(dir, "Missing.elk"), err: true},
+		{mix: bad, err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLoadMix(tt.mix, STAMAC)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseLoadMix(%q) succeeded, want error", tt.mix)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLoadMix(%q) error: %v", tt.mix, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseLoadMix(%q) returned %d requests, want %d", tt.mix, len(got), len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			r := got[i]
+			if r.Name != w.name || r.Request["type"] != w.typ || r.Weight != w.weight || r.TimeOut != w.timeout {
+				t.Errorf("ParseLoadMix(%q)[%d] = %s %v %d %v, want %s %s %d %v",
+					tt.mix, i, r.Name, r.Request["type"], r.Weight, r.TimeOut, w.name, w.typ, w.weight, w.timeout)
+			}
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	ms := func(v ...int) []time.Duration {
+		var d []time.Duration
+		for _, x := range v {
+			d = append(d, time.Duration(x)*time.Millisecond)
+		}
+		return d
+	}
+	hundred := make([]int, 100)
+	for i := range hundred {
+		hundred[i] = i + 1
+	}
+
+	tests := []struct {
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{nil, 0.5, 0},
+		{ms(7), 0.5, 7 * time.Millisecond},
+		{ms(7), 0.99, 7 * time.Millisecond},
+		{ms(1, 2), 0.5, 1 * time.Millisecond},
+		{ms(1, 2), 0.95, 2 * time.Millisecond},
+		{ms(1, 2, 3, 4), 0.5, 2 * time.Millisecond},
+		{ms(1, 2, 3, 4), 0.75, 3 * time.Millisecond},
+		{ms(hundred...), 0, 1 * time.Millisecond},
+		{ms(hundred...), 0.5, 50 * time.Millisecond},
+		{ms(hundred...), 0.95, 95 * time.Millisecond},
+		{ms(hundred...), 0.99, 99 * time.Millisecond},
+		{ms(hundred...), 1, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%d values, %v) = %v, want %v", len(tt.sorted), tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestLoadStatsPercentiles(t *testing.T) {
+	s := &loadStats{}
+	for i := 100; i >= 1; i-- {
+		s.latencies = append(s.latencies, time.Duration(i)*time.Millisecond)
+	}
+	p50, p95, p99 := s.percentiles()
+	if p50 != 50*time.Millisecond || p95 != 95*time.Millisecond || p99 != 99*time.Millisecond {
+		t.Errorf("percentiles() = %v %v %v, want 50ms 95ms 99ms", p50, p95, p99)
+	}
+	if s.latencies[0] != 100*time.Millisecond {
+		t.Error("percentiles() sorted the recorded latencies in place")
+	}
+}
+
+func TestLoadOptionsValidate(t *testing.T) {
+	tests := []struct {
+		rate        float64
+		concurrency int
+		ok          bool
+	}{
+		{rate: 50, ok: true},
+		{rate: 0.5, ok: true},
+		{rate: LoadMaxRate, ok: true},
+		{rate: 0, concurrency: 1, ok: true},
+		{rate: 0, concurrency: 0},
+		{rate: 0, concurrency: -1},
+		{rate: -1, concurrency: 1},
+		{rate: LoadMaxRate + 1},
+		{rate: 2e9},
+		{rate: math.Inf(1)},
+		{rate: math.NaN(), concurrency: 1},
+	}
+	for _, tt := range tests {
+		err := LoadOptions{Rate: tt.rate, Concurrency: tt.concurrency}.Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("Validate(rate %v, concurrency %d) = %v, want ok %v", tt.rate, tt.concurrency, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coredhcp/coredhcp/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// 日志的输出格式
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// 人工提示期间最多暂存的日志条数，超过时丢弃最早的
+const logHoldLimit = 1000
+
+// Log 是程序唯一的日志。e-Link消息、测试过程和DHCP服务的日志都经过它，
+// 由-loglevel过滤，-logformat选择文本或JSON格式，-logfile追加到文件
+var Log = newLogger()
+
+// 日志标记对应的级别，[I]和[O]是收到和发出的e-Link消息
+var logTagLevels = map[string]logrus.Level{
+	"[E]": logrus.ErrorLevel,
+	"[W]": logrus.WarnLevel,
+	"[T]": logrus.InfoLevel,
+	"[I]": logrus.InfoLevel,
+	"[O]": logrus.InfoLevel,
+	"[-]": logrus.DebugLevel,
+}
+
+// 没有标记的日志，如DHCP服务的日志，按级别显示的标记
+var logLevelTags = map[logrus.Level]string{
+	logrus.PanicLevel: "[E]",
+	logrus.FatalLevel: "[E]",
+	logrus.ErrorLevel: "[E]",
+	logrus.WarnLevel:  "[W]",
+	logrus.InfoLevel:  "[I]",
+	logrus.DebugLevel: "[-]",
+	logrus.TraceLevel: "[-]",
+}
+
+// -loglevel可以使用的级别，none不输出到控制台，但仍然写入-logfile
+var logLevels = map[string]func(*logrus.Logger){
+	"none":    func(l *logrus.Logger) { SetLogOutput(ioutil.Discard) },
+	"debug":   func(l *logrus.Logger) { l.SetLevel(logrus.DebugLevel) },
+	"info":    func(l *logrus.Logger) { l.SetLevel(logrus.InfoLevel) },
+	"warning": func(l *logrus.Logger) { l.SetLevel(logrus.WarnLevel) },
+	"error":   func(l *logrus.Logger) { l.SetLevel(logrus.ErrorLevel) },
+	"fatal":   func(l *logrus.Logger) { l.SetLevel(logrus.FatalLevel) },
+}
+
+func getLogLevels() []string {
+	var levels []string
+	for k := range logLevels {
+		levels = append(levels, k)
+	}
+	sort.Strings(levels)
+	return levels
+}
+
+// logOutput 是日志在控制台的输出，人工提示期间暂存日志，提示结束后再输出
+type logOutput struct {
+	locker  sync.Mutex
+	w       io.Writer
+	hold    bool
+	held    [][]byte
+	dropped int
+}
+
+var logOut = &logOutput{w: os.Stdout}
+
+func (o *logOutput) Write(p []byte) (int, error) {
+	o.locker.Lock()
+	defer o.locker.Unlock()
+
+	if !o.hold {
+		return o.w.Write(p)
+	}
+	if len(o.held) >= logHoldLimit {
+		o.held = o.held[1:]
+		o.dropped++
+	}
+	o.held = append(o.held, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+// LogOutput 返回日志当前的控制台输出
+func LogOutput() io.Writer {
+	logOut.locker.Lock()
+	defer logOut.locker.Unlock()
+	return logOut.w
+}
+
+// SetLogOutput 替换日志的控制台输出，如全屏界面、控制台的行编辑终端或测试记录文件，返回原来的输出
+func SetLogOutput(w io.Writer) io.Writer {
+	logOut.locker.Lock()
+	defer logOut.locker.Unlock()
+	old := logOut.w
+	logOut.w = w
+	return old
+}
+
+// LogEnable 为false时暂存控制台日志，避免打断人工提示，为true时输出暂存的日志
+func LogEnable(enable bool) {
+	logOut.locker.Lock()
+	if !enable {
+		logOut.hold = true
+		logOut.locker.Unlock()
+		return
+	}
+	held, dropped := logOut.held, logOut.dropped
+	logOut.hold, logOut.held, logOut.dropped = false, nil, 0
+	for _, v := range held {
+		logOut.w.Write(v)
+	}
+	logOut.locker.Unlock()
+
+	if dropped > 0 {
+		LogPrintln("[W]", fmt.Sprintf(L("提示期间的日志过多，丢弃了最早的 %d 条"), dropped))
+	}
+}
+
+// 附加到之后每条e-Link日志的字段：当前会话的设备MAC(mac)和正在执行的测试(test)
+var logFields = struct {
+	sync.Mutex
+	m logrus.Fields
+}{m: logrus.Fields{}}
+
+// SetLogField 设置附加到之后每条日志的字段，value为空时删除
+func SetLogField(key, value string) {
+	logFields.Lock()
+	defer logFields.Unlock()
+	if value == "" {
+		delete(logFields.m, key)
+	} else {
+		logFields.m[key] = value
+	}
+}
+
+// logEntry 返回带有当前字段和标记的日志
+func logEntry(tag string, extra logrus.Fields) *logrus.Entry {
+	logFields.Lock()
+	fields := make(logrus.Fields, len(logFields.m)+len(extra)+1)
+	for k, v := range logFields.m {
+		fields[k] = v
+	}
+	logFields.Unlock()
+
+	for k, v := range extra {
+		fields[k] = v
+	}
+	if tag != "" {
+		fields["tag"] = tag
+	}
+	return Log.WithFields(fields)
+}
+
+func logLine(tag string, extra logrus.Fields, msg string) {
+	level, ok := logTagLevels[tag]
+	if !ok {
+		level = logrus.InfoLevel
+	}
+	logEntry(tag, extra).Log(level, msg)
+}
+
+// LogPrintln 输出一条日志，第一个参数是[T]、[E]、[W]等标记时按标记确定级别
+func LogPrintln(a ...interface{}) {
+	tag := ""
+	if len(a) > 0 {
+		if s, ok := a[0].(string); ok {
+			if _, ok := logTagLevels[s]; ok {
+				tag = s
+				a = a[1:]
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	for argNum, arg := range a {
+		if argNum > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(fmt.Sprint(arg))
+	}
+	logLine(tag, nil, buf.String())
+}
+
+// LogPrintf 按格式输出一条不带标记的info日志
+func LogPrintf(format string, a ...interface{}) {
+	logLine("", nil, strings.TrimRight(fmt.Sprintf(format, a...), "\n"))
+}
+
+// LogMessage 输出一条收发的e-Link消息，dir为"I"或"O"
+func LogMessage(dir string, msg string) {
+	logLine("["+dir+"]", logrus.Fields{"dir": dir}, msg)
+}
+
+// logTextFormatter 是文本格式：时间、标记、DHCP插件的前缀和消息，字段只在JSON格式中输出
+type logTextFormatter struct{}
+
+func (logTextFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	tag, ok := e.Data["tag"].(string)
+	if !ok {
+		tag = logLevelTags[e.Level]
+	}
+
+	var b bytes.Buffer
+	b.WriteString(e.Time.Format("2006-01-02 15:04:05"))
+	b.WriteString(" " + tag + " ")
+	if prefix, ok := e.Data["prefix"].(string); ok {
+		b.WriteString(prefix + ": ")
+	}
+	b.WriteString(e.Message)
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// logFileHook 把日志按当前格式追加到-logfile，不受控制台输出和人工提示的影响
+type logFileHook struct {
+	f *os.File
+}
+
+func (h *logFileHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *logFileHook) Fire(e *logrus.Entry) error {
+	b, err := e.Logger.Formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	_, err = h.f.Write(b)
+	return err
+}
+
+// newLogger 使用coredhcp的全局日志，DHCP插件的日志也按同样的格式输出
+func newLogger() *logrus.Logger {
+	l := logger.GetLogger("elinks").Logger
+	l.SetFormatter(logTextFormatter{})
+	l.SetOutput(logOut)
+	return l
+}
+
+// SetupLog 按-loglevel、-logformat、-logfile和-nostdout设置日志
+func SetupLog(level, format, file string, nostdout bool) error {
+	switch format {
+	case LogFormatText:
+		Log.SetFormatter(logTextFormatter{})
+	case LogFormatJSON:
+		Log.SetFormatter(&logrus.JSONFormatter{TimestampFormat: "2006-01-02T15:04:05.000Z07:00"})
+	default:
+		return fmt.Errorf(L("无效的日志格式: %s，可以是 %s 或 %s"), format, LogFormatText, LogFormatJSON)
+	}
+
+	fn, ok := logLevels[level]
+	if !ok {
+		return fmt.Errorf(L("无效的日志级别: %s，可以是 %v"), level, getLogLevels())
+	}
+	fn(Log)
+
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		Log.AddHook(&logFileHook{f: f})
+	}
+	if nostdout {
+		SetLogOutput(ioutil.Discard)
+	}
+	return nil
+}
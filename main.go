@@ -1,21 +1,19 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
-	"os/user"
-	"strconv"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/coredhcp/coredhcp/config"
-	"github.com/coredhcp/coredhcp/logger"
 	"github.com/coredhcp/coredhcp/server"
-	"github.com/sirupsen/logrus"
 
 	"github.com/coredhcp/coredhcp/plugins"
 	pl_dns "github.com/coredhcp/coredhcp/plugins/dns"
@@ -36,29 +34,60 @@ var (
 	flagPort        = flag.String("port", "32768", "侦听端口")
 	flagFile        = flag.String("file", "TestQueue.txt", "测试队列文件名")
 	flagTmac        = flag.String("tmac", "", "测试手机的MAC地址")
-	flagLogFile     = flag.String("logfile", "", "Name of the log file to append to. Default: stdout/stderr only")
-	flagLogNoStdout = flag.Bool("nostdout", false, "Disable logging to stdout/stderr")
-	flagLogLevel    = flag.String("loglevel", "info", fmt.Sprintf("Log level. One of %v", getLogLevels()))
-	flagConfig      = flag.String("conf", "dhcp.yml", "Use this configuration file instead of the default location")
-	flagPlugins     = flag.Bool("plugins", false, "list plugins")
+	flagLogFile     = flag.String("logfile", "", "追加日志的文件名，缺省只输出到标准输出和标准错误")
+	flagLogNoStdout = flag.Bool("nostdout", false, "不输出日志到标准输出和标准错误")
+	flagLogLevel    = flag.String("loglevel", "info", "日志级别，可以是 %v")
+	flagLogFormat   = flag.String("logformat", LogFormatText, "日志格式：text 文本，json 每行一个JSON对象")
+	flagConfig      = flag.String("conf", "dhcp.yml", "DHCP服务器的配置文件")
+	flagPlugins     = flag.Bool("plugins", false, "列出DHCP插件")
+	flagSnapshot    = flag.Bool("snapshot", true, "测试前保存设备配置，测试后自动恢复")
+	flagTags        = flag.String("tags", "", "只执行带有这些标签的测试用例，多个标签用逗号分隔")
+	flagSkipTags    = flag.String("skip-tags", "", "跳过带有这些标签的测试用例，多个标签用逗号分隔")
+	flagRun         = flag.String("run", "", "只执行名称匹配这些通配符的测试用例，如 \"*LED*,CPURate.elk\"")
+	flagSkip        = flag.String("skip", "", "跳过名称匹配这些通配符的测试用例，如 \"*_manual.elk\"")
+	flagTable       = flag.String("table", "", "只执行这些接口表的测试用例，如 \"表10,表21\"")
+	flagUnattended  = flag.Bool("unattended", false, "无人值守，不等待人工确认，标准输入不是终端时自动启用")
+	flagManual      = flag.String("manual-policy", ManualSkip, "无人值守或提示超时时对人工步骤的处理：skip 跳过，confirm 自动确认")
+	flagPromptTime  = flag.Int("prompt-timeout", 0, "人工提示的等待秒数，0表示一直等待")
+	flagActionTime  = flag.Int("action-timeout", 300, "^Action^命令的最长执行秒数，超时后终止命令，0表示不限时")
+	flagTimeOut     = flag.Int("timeout", 0, "测试总时间秒数，超时后停止测试，0表示不限制")
+	flagConnTimeOut = flag.Int("connect-timeout", 300, "等待设备连接并完成注册的秒数，0表示一直等待")
+	flagIterations  = flag.Int("iterations", 0, "soak命令重复执行测试队列的轮数，0表示不限制")
+	flagDuration    = flag.Duration("duration", 0, "soak命令重复执行测试队列的时长，如 8h，0表示不限制；load命令缺省为1m")
+	flagRate        = flag.Float64("rate", 0, "load命令每秒发送的请求数，0表示按-concurrency并发发送")
+	flagConcurrency = flag.Int("concurrency", 1, "load命令同时等待应答的请求数")
+	flagMix         = flag.String("mix", LoadDefaultMix, "load命令的请求组合，get_status名称或用例文件，冒号后是权重，如 \"cpurate:3,LEDSwitchON.elk\"")
+	flagRunDir      = flag.String("rundir", "", "保存每个测试的结果和记录的目录，缺省为 runs/开始时间")
+	flagResume      = flag.String("resume", "", "从运行目录继续中断的测试，跳过已完成的测试")
+	flagTUI         = flag.Bool("tui", false, "全屏显示测试队列、当前测试、设备信息和消息日志")
+	flagHTTP        = flag.String("http", "", "HTTP控制接口和网页仪表盘的侦听地址，如 \":8080\"只侦听本机，\"0.0.0.0:8080\"侦听全部网卡，缺省不启用")
+	flagHTTPToken   = flag.String("http-token", "", "HTTP控制接口的访问令牌，缺省每次启动时随机生成并输出在日志中")
+	flagReportConf  = flag.String("report-conf", defaultReportConfig, "报告配置文件，设置报告头的信息和报告模板，缺省文件不存在时使用内置的信息和模板")
+	flagReportSet   = flag.String("report-set", "", "修改报告头的信息，如 \"client=某某公司,location=3号实验室,委托单号=WQ-001\"，standard/client/location/version/tester/transcripts以外的名称作为自定义项目")
+	flagReportJSON  = flag.String("report-json", "", "测试结束后把包含设备信息、请求、收到的消息和关键词匹配情况的报告写入这个JSON文件")
+	flagReportJUnit = flag.String("report-junit", "", "测试结束后把JUnit XML格式的报告写入这个文件，供CI系统读取")
+	flagReportHTML  = flag.String("report-html", "", "测试结束后把不依赖外部资源的HTML报告写入这个文件")
+	flagReportDocx  = flag.String("report-docx", "", "测试结束后把Word格式的一致性测试报告写入这个.docx文件")
+	flagSpec        = flag.String("spec", "", "覆盖率统计使用的规范目录JSON文件，缺省使用内置的Q/CT2621-2017目录")
+	flagHistory     = flag.String("history", "history", "保存每次测试结果的历史记录目录，为空时不保存")
+	flagModel       = flag.String("model", "", "compare命令比较的设备型号，缺省为两个版本都有记录的型号")
+	flagSignKey     = flag.String("sign-key", "", "测试结束后用这个PEM格式的Ed25519私钥签名运行目录中的报告、测试记录和日志的SHA-256清单")
+	flagPubKey      = flag.String("pubkey", "", "verify命令使用的PEM格式的Ed25519公钥，缺省使用清单中的公钥")
+	flagLang        = flag.String("lang", "", "日志、提示和报告的语言，zh-CN或en，缺省使用ELINKS_LANG环境变量，没有设置时为zh-CN")
 )
 
-var logLevels = map[string]func(*logrus.Logger){
-	"none":    func(l *logrus.Logger) { l.SetOutput(ioutil.Discard) },
-	"debug":   func(l *logrus.Logger) { l.SetLevel(logrus.DebugLevel) },
-	"info":    func(l *logrus.Logger) { l.SetLevel(logrus.InfoLevel) },
-	"warning": func(l *logrus.Logger) { l.SetLevel(logrus.WarnLevel) },
-	"error":   func(l *logrus.Logger) { l.SetLevel(logrus.ErrorLevel) },
-	"fatal":   func(l *logrus.Logger) { l.SetLevel(logrus.FatalLevel) },
-}
-
-func getLogLevels() []string {
-	var levels []string
-	for k := range logLevels {
-		levels = append(levels, k)
-	}
-	return levels
-}
+// 命令行第一个参数可以是子命令，缺省为run
+const usageCommands = `Commands:
+  run      连接被测设备并执行测试队列（缺省）
+  list     只列出筛选后的测试队列，不启动侦听
+  console  连接被测设备后进入交互控制台，手工收发e-Link消息
+  serve    只启动侦听和HTTP控制接口，由网页或HTTP请求启动测试
+  soak     重复执行测试队列，输出稳定性测试报告
+  load     以一定速率或并发发送请求，输出控制面负载测试报告
+  coverage 统计测试队列对Q/CT2621-2017各表和get_status查询名称的覆盖情况
+  compare  比较同一型号两个软件版本的历史测试结果，如 compare V1.0 V1.1，不指定版本时列出历史记录
+  verify   校验运行目录中签名清单的签名和文件的SHA-256，如 verify -pubkey lab.pub runs/20060102-150405
+`
 
 var desiredPlugins = []*plugins.Plugin{
 	&pl_dns.Plugin,
@@ -72,10 +101,48 @@ var desiredPlugins = []*plugins.Plugin{
 	&pl_searchdomains.Plugin,
 	&pl_serverid.Plugin,
 	&pl_sleep.Plugin,
+	&leasePlugin,
 }
 
 func main() {
-	flag.Parse()
+	command := "run"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+	if lang := os.Getenv("ELINKS_LANG"); lang != "" {
+		if err := SetLocale(lang); err != nil {
+			fmt.Fprintln(os.Stderr, "ELINKS_LANG:", err)
+		}
+	}
+	// -h在解析参数时就输出帮助，所以要先设置语言，无效的-lang在解析后报错
+	if lang := langArg(args); lang != "" {
+		SetLocale(lang)
+	}
+	if f := flag.Lookup("loglevel"); f != nil {
+		f.Usage = fmt.Sprintf(L(f.Usage), getLogLevels())
+	}
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [command] [flags]\n%s\nFlags:\n", os.Args[0], L(usageCommands))
+		flag.VisitAll(func(f *flag.Flag) {
+			f.Usage = L(f.Usage)
+		})
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(args)
+	if *flagLang != "" {
+		if err := SetLocale(*flagLang); err != nil {
+			fmt.Fprintln(os.Stderr, "-lang:", err)
+			os.Exit(ExitError)
+		}
+	}
+	switch command {
+	case "run", "list", "console", "serve", "soak", "load", "compare", "coverage", "verify":
+	default:
+		flag.Usage()
+		os.Exit(ExitError)
+	}
 
 	// 只是输出插件信息
 	if *flagPlugins {
@@ -85,167 +152,443 @@ func main() {
 		os.Exit(0)
 	}
 
-	// 设置LOG
-	log := logger.GetLogger("main")
-	fn, ok := logLevels[*flagLogLevel]
-	if !ok {
-		log.Fatalf("Invalid log level '%s'. Valid log levels are %v", *flagLogLevel, getLogLevels())
+	// 只是比较历史记录，不需要连接设备
+	if command == "compare" {
+		os.Exit(CompareHistory(*flagHistory, *flagModel, flag.Args()))
 	}
-	fn(log.Logger)
-	log.Infof("Setting log level to '%s'", *flagLogLevel)
 
-	// LOG到文件
-	if *flagLogFile != "" {
-		log.Infof("Logging to file %s", *flagLogFile)
-		logger.WithFile(log, *flagLogFile)
+	// 只是校验运行目录的签名，不需要连接设备
+	if command == "verify" {
+		if flag.NArg() != 1 {
+			LogPrintln("[E]", L("用法: verify [-pubkey 公钥文件] <运行目录>"))
+			os.Exit(ExitError)
+		}
+		os.Exit(VerifyRunDir(flag.Arg(0), *flagPubKey))
 	}
-	if *flagLogNoStdout {
-		log.Infof("Disabling logging to stdout/stderr")
-		logger.WithNoStdOutErr(log)
+
+	// 设置日志，e-Link消息、测试过程和DHCP服务使用同一个日志
+	if err := SetupLog(*flagLogLevel, *flagLogFormat, *flagLogFile, *flagLogNoStdout); err != nil {
+		LogPrintln("[E]", L("设置日志错误:"), err)
+		os.Exit(ExitError)
 	}
 
-	// DHCP配置文件
-	config, err := config.Load(*flagConfig)
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+	// 报告头的信息和报告模板
+	if conf, err := LoadReportConfig(*flagReportConf, SplitList(*flagReportSet)); err != nil {
+		LogPrintln("[E]", L("读取报告配置错误:"), *flagReportConf, err)
+		os.Exit(ExitError)
+	} else {
+		Report = conf
+	}
+	if command == "run" || command == "soak" {
+		for _, v := range Report.Unset() {
+			LogPrintln("[W]", fmt.Sprintf(L("报告配置中没有设置%s，报告中这一项为空，可以在%s中设置或用-report-set %s=...指定"), v, *flagReportConf, v))
+		}
 	}
 
-	// 注册DHCP插件
-	for _, plugin := range desiredPlugins {
-		if err := plugins.RegisterPlugin(plugin); err != nil {
-			log.Fatalf("Failed to register plugin '%s': %v", plugin.Name, err)
+	// 报告签名的私钥
+	if *flagSignKey != "" {
+		signer, err := LoadSigner(*flagSignKey)
+		if err != nil {
+			LogPrintln("[E]", L("读取签名私钥错误:"), *flagSignKey, err)
+			os.Exit(ExitError)
 		}
+		Signer = signer
+		LogPrintln("[T]", L("报告签名公钥指纹"), Signer.Fingerprint())
 	}
 
-	// 测试手机地址必须指定
+	// 继续中断的测试时，用运行目录中保存的参数重新生成测试队列
+	var checkpoint *Checkpoint
+	runStart := time.Now()
+	if *flagResume != "" {
+		var params *RunParams
+		var err error
+		checkpoint, params, err = OpenCheckpoint(*flagResume)
+		if err != nil || command != "run" {
+			flag.Usage()
+			LogPrintln("[E]", L("不能继续测试:"), *flagResume, err)
+			os.Exit(ExitError)
+		}
+		*flagFile, *flagTmac = params.File, params.TMAC
+		*flagTags, *flagSkipTags, *flagRun, *flagSkip, *flagTable = params.Tags, params.SkipTags, params.Run, params.Skip, params.Table
+		runStart = params.Start
+		LogPrintln("[T]", fmt.Sprintf(L("继续测试 %s，已完成 %d 项"), *flagResume, checkpoint.Completed()))
+	}
+
+	// 覆盖率统计使用的规范目录
+	if *flagSpec != "" {
+		tables, err := LoadSpecTables(*flagSpec)
+		if err != nil {
+			LogPrintln("[E]", L("读取规范目录错误:"), *flagSpec, err)
+			os.Exit(ExitError)
+		}
+		SpecTables = tables
+	}
+
+	// 测试手机地址必须指定，只列出队列或控制台模式时可以不指定
 	testMAC := strings.ToUpper(strings.Replace(*flagTmac, ":", "", -1))
+	if testMAC == "" && command != "run" && command != "soak" {
+		testMAC = STAMAC
+	}
 	if len(testMAC) != 12 {
 		flag.Usage()
-		LogPrintln("E", "无效的测试手机MAC地址[", testMAC, "]")
-		os.Exit(1)
+		LogPrintln("[E]", L("无效的测试手机MAC地址["), testMAC, "]")
+		os.Exit(ExitError)
 	}
 
 	// Init test queue
-	queue, err := CreateTestQueueFromFile(*flagFile, testMAC)
-	if queue == nil {
+	var suite *TestSuite
+	if command == "serve" && *flagHTTP == "" {
+		flag.Usage()
+		LogPrintln("[E]", L("serve命令需要指定-http侦听地址"))
+		os.Exit(ExitError)
+	}
+	if command == "run" || command == "list" || command == "soak" || command == "coverage" {
+		var err error
+		suite, err = CreateTestSuiteFromFile(*flagFile, testMAC)
+		if suite == nil {
+			flag.Usage()
+			LogPrintln("[E]", L("解析TestQueue错误："), err)
+			os.Exit(ExitError)
+		}
+		suite.Items = suite.Items.Filter(&TestFilter{
+			Tags:      SplitList(*flagTags),
+			SkipTags:  SplitList(*flagSkipTags),
+			Names:     SplitList(*flagRun),
+			SkipNames: SplitList(*flagSkip),
+			Tables:    SplitList(*flagTable),
+		})
+	}
+	if command == "list" {
+		listSuite(suite)
+		os.Exit(0)
+	}
+	if command == "coverage" {
+		coverage := NewCoverage(suite.Items, SpecTables)
+		coverage.Print()
+		if *flagReportJSON != "" {
+			if err := coverage.Save(*flagReportJSON); err != nil {
+				LogPrintln("[E]", L("保存覆盖情况错误:"), err)
+				os.Exit(ExitError)
+			}
+			LogPrintln("[T]", L("覆盖情况保存在"), *flagReportJSON)
+		}
+		os.Exit(0)
+	}
+
+	// 每个测试结束时保存结果，异常退出后可以用-resume继续
+	if command == "run" && checkpoint == nil {
+		dir := *flagRunDir
+		if dir == "" {
+			dir = filepath.Join("runs", time.Now().Format("20060102-150405"))
+		}
+		var err error
+		checkpoint, err = CreateCheckpoint(dir, RunParams{
+			File:     *flagFile,
+			TMAC:     testMAC,
+			Tags:     *flagTags,
+			SkipTags: *flagSkipTags,
+			Run:      *flagRun,
+			Skip:     *flagSkip,
+			Table:    *flagTable,
+			Start:    runStart,
+		})
+		if err != nil {
+			LogPrintln("[E]", L("创建运行目录错误:"), err)
+			os.Exit(ExitError)
+		}
+		LogPrintln("[T]", fmt.Sprintf(L("测试结果保存在 %[1]s，中断后可以用 -resume %[1]s 继续"), dir))
+	}
+
+	// 负载测试的请求组合
+	var loadOpts LoadOptions
+	if command == "load" {
+		mix, err := ParseLoadMix(*flagMix, testMAC)
+		loadOpts = LoadOptions{Rate: *flagRate, Concurrency: *flagConcurrency, Duration: *flagDuration, Mix: mix}
+		if err == nil {
+			err = loadOpts.Validate()
+		}
+		if err != nil {
+			flag.Usage()
+			LogPrintln("[E]", L("无效的负载测试参数:"), err)
+			os.Exit(ExitError)
+		}
+		if loadOpts.Duration == 0 {
+			loadOpts.Duration = time.Minute
+		}
+	}
+
+	// 人工步骤的处理方式
+	if *flagManual != ManualSkip && *flagManual != ManualConfirm {
 		flag.Usage()
-		LogPrintln("E", "解析TestQueue错误：", err)
-		os.Exit(1)
+		LogPrintln("[E]", L("无效的人工步骤处理策略["), *flagManual, "]")
+		os.Exit(ExitError)
+	}
+	unattended := *flagUnattended
+	if *flagHTTP != "" {
+		// 人工步骤可以在网页上确认
+		PromptRemote = true
+	} else if !unattended && (command == "run" || command == "soak") && !IsTerminal(os.Stdin) {
+		LogPrintln("[W]", L("标准输入不是终端，启用无人值守模式"))
+		unattended = true
 	}
 
+	// DHCP配置文件
+	config, err := config.Load(*flagConfig)
+	if err != nil {
+		LogPrintln("[E]", L("读取DHCP配置错误:"), *flagConfig, err)
+		os.Exit(ExitError)
+	}
+
+	// 注册DHCP插件
+	for _, plugin := range desiredPlugins {
+		if err := plugins.RegisterPlugin(watchLeases(plugin)); err != nil {
+			LogPrintln("[E]", L("注册DHCP插件错误:"), plugin.Name, err)
+			os.Exit(ExitError)
+		}
+	}
+	addLeasePlugin(config)
+
 	// Start dhcp server
 	srv, err := server.Start(config)
 	if err != nil {
-		log.Fatal(err)
+		LogPrintln("[E]", L("启动DHCP服务错误:"), err)
+		os.Exit(ExitError)
 	}
 
 	// Start to listen
+	l, err := net.Listen("tcp", *flagHost+":"+*flagPort)
+	if err != nil {
+		LogPrintln("[E]", "Error listening:", err)
+		os.Exit(ExitError)
+	}
+	shutdown := make(chan struct{})
 	cli := NewClient()
-	go handleListen(&cli)
+	opts := RunOptions{
+		Snapshot:      *flagSnapshot,
+		Unattended:    unattended,
+		ManualPolicy:  *flagManual,
+		PromptTimeOut: *flagPromptTime,
+		ActionTimeOut: *flagActionTime,
+	}
+	runner := NewRunner(&cli, opts)
+	runner.SetCheckpoint(checkpoint)
 
-	// Wait client ready
-	cli.WaitReady()
-
-	// Do tests
-	for _, q := range queue {
-		LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
-		LogPrintln("[T]", "测试名称:", q.Name)
-		if q.Interface != "" {
-			LogPrintln("[T]", "接口名称:", q.Interface)
-		}
-		LogPrintln("[T]", "超时时间:", q.RecTimeOut, "秒")
-		LogPrintln("[T]", "词语匹配:", q.ResponseKeyWord)
-
-		// Prompt user to press key
-		if q.MessageBox != "" {
-			LogPrintln("[T]", "---", q.MessageBox, "---")
-			LogPrintln("[T]", "---", "按回车键继续", ">>>>>>>>")
-			LogEnable(false)
-			reader := bufio.NewReader(os.Stdin)
-			reader.ReadString('\n')
-			LogEnable(true)
-		}
-
-		// Send request
-		testBegin := time.Now()
-		LogPrintln("[T]", "打印开始:", "vvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvv")
-		cli.SendRequest(q.Request)
-
-		// Wait response and check keywords
-		q.Pass = cli.WaitAndCheckResponse(
-			q.RecTimeOut, q.ResponseKeyWord)
-
-		LogPrintln("[T]", "打印结束:", "^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^")
-
-		// Show result
-		LogPrintln("[T]", "花费时间:", time.Now().Sub(testBegin).Seconds(), "秒")
-		LogPrintln("[T]", "测试结果:", strconv.FormatBool(q.Pass))
-		LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
-	}
-
-	// Auto get tester's name
-	username := "nobody"
-	if u, err := user.Current(); err == nil {
-		username = u.Username
-	}
-
-	// Dump test result
-	count := 0
-	LogPrintln("[T]", "===============================================================================================")
-	LogPrintln("[T]", cli.vendor, "公司", cli.model, "产品e-Link自组网接口一致性测试报告")
-	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
-	LogPrintln("[T]", "测试依据：", "《中国电信家庭终端与智能家庭网关自动连接的接口技术要求》(Q/CT2621-2017)")
-	LogPrintln("[T]", "委托单位：", "北京微桥信息技术有限公司")
-	LogPrintln("[T]", "测试地点：", "量子银座")
-	LogPrintln("[T]", "测试时间：", time.Now())
-	LogPrintln("[T]", "版 本 号：", "1.0")
-	LogPrintln("[T]", "测试人员：", username)
-	LogPrintln("[T]", "连接次数：", cli.connTimes)
-	LogPrintln("[T]", "===============================================================================================")
-	LogPrintln("[T]", "序号", "|", FW("测试接口名称", 40), "|", FW("测试用例名称", 34), "|", "测试结果")
-	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
-	for _, v := range queue {
-		if v.Interface != "" {
-			count++
-			index := fmt.Sprintf("%4v", count)
-			title := FW(v.Interface, 40)
-			name := FW(v.Name, 34)
-			pass := "不通过"
-			if v.Pass {
-				pass = "通过"
+	// HTTP控制接口要在设备连接前注册，才能看到全部消息
+	var web *HTTPServer
+	if *flagHTTP != "" {
+		web = NewHTTPServer(&cli, testMAC, opts, *flagHTTPToken)
+		if command == "run" {
+			web.Attach(runner, suite)
+		}
+		go func() {
+			if err := web.ListenAndServe(*flagHTTP); err != nil {
+				LogPrintln("[E]", L("HTTP控制接口错误:"), err)
+				runner.Stop(fmt.Sprint(L("HTTP控制接口错误 "), err))
 			}
-			LogPrintln("[T]", index, "|", title, "|", name, "|", pass)
+		}()
+	}
+
+	// 稳定性测试要在设备连接前注册，才能记录全部心跳
+	var soak *Soak
+	if command == "soak" {
+		soak = NewSoak(&cli, runner, SoakOptions{Iterations: *flagIterations, Duration: *flagDuration})
+	}
+	go handleListen(l, &cli, shutdown)
+
+	// 全屏界面只用于执行测试队列，终端不支持时仍然逐行输出
+	var tui *TUI
+	if *flagTUI && command == "run" {
+		tui = NewTUI(&cli, runner, suite)
+		if err := tui.Start(); err != nil {
+			LogPrintln("[W]", L("不能启用全屏界面:"), err)
+			tui = nil
 		}
 	}
-	LogPrintln("[T]", "===============================================================================================")
 
-	// 关闭dhcp服务器
-	if err := srv.Wait(); err != nil {
-		log.Print(err)
+	// 第一次收到信号时停止测试，执行清理步骤后结束，再次收到时立即退出
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		LogPrintln("[W]", fmt.Sprintf(L("收到信号 %v，停止测试，再次按Ctrl+C立即退出"), sig))
+		runner.Stop(fmt.Sprint(L("收到信号 "), sig))
+		<-sigs
+		tui.Close()
+		LogPrintln("[E]", L("再次收到信号，立即退出"))
+		runner.ForceRestore(forcedRestoreTimeOut)
+		os.Exit(ExitInterrupted)
+	}()
+	if *flagTimeOut > 0 {
+		time.AfterFunc(time.Duration(*flagTimeOut)*time.Second, func() {
+			LogPrintln("[W]", fmt.Sprintf(L("测试总时间超过 %d 秒，停止测试"), *flagTimeOut))
+			runner.Stop(fmt.Sprintf(L("测试总时间超过 %d 秒"), *flagTimeOut))
+		})
+	}
+
+	// Wait client ready
+	code := ExitError
+	if command == "console" {
+		NewConsole(&cli, testMAC).Run()
+		code = ExitPass
+	} else if command == "serve" {
+		// 一直提供服务，直到收到信号，再停止通过HTTP启动的测试
+		<-runner.Done()
+		web.Stop(runner.Interrupted())
+		code = ExitPass
+	} else if command == "soak" && cli.WaitReadyTimeout(*flagConnTimeOut, runner.Done()) {
+		soak.Run(suite, *flagConnTimeOut)
+		soak.PrintReport(runner.Interrupted())
+		code = soak.ExitCode(runner.Interrupted())
+	} else if command == "load" && cli.WaitReadyTimeout(*flagConnTimeOut, runner.Done()) {
+		code = runLoad(&cli, loadOpts, runner)
+	} else if command == "run" && cli.WaitReadyTimeout(*flagConnTimeOut, runner.Done()) {
+		// Do tests
+		runner.RunSuite(suite)
+		tui.Close()
+		text := printReport(&cli, suite, runner.Interrupted())
+		saveHistory(&cli, suite, runStart, checkpoint, runner.Interrupted())
+		saveReports(&cli, suite, runStart, checkpoint, runner.Interrupted())
+		signReports(&cli, checkpoint, text)
+		code = ExitCode(suite.Items, runner.Interrupted())
+	} else if tui.Close(); runner.Interrupted() != "" {
+		LogPrintln("[E]", L("等待设备连接时中断:"), runner.Interrupted())
+		code = ExitInterrupted
+	} else {
+		LogPrintln("[E]", fmt.Sprintf(L("等待设备连接超时: %d 秒"), *flagConnTimeOut))
 	}
-	time.Sleep(time.Second)
+
+	// 关闭侦听、设备连接和dhcp服务器
+	close(shutdown)
+	l.Close()
+	cli.Close()
+	srv.Close()
+	os.Exit(code)
 }
 
-func handleListen(cli *Client) {
-	var l net.Listener
-	var err error
-	l, err = net.Listen("tcp", *flagHost+":"+*flagPort)
-	if err != nil {
-		LogPrintln("[E]", "Error listening:", err)
-		os.Exit(1)
+// saveHistory 把本次测试的设备信息和结果保存到历史记录目录
+func saveHistory(cli *Client, suite *TestSuite, start time.Time, checkpoint *Checkpoint, interrupted string) {
+	if *flagHistory == "" {
+		return
+	}
+	h := NewHistoryRecord(cli, suite, *flagFile, start, interrupted)
+	if checkpoint != nil {
+		h.RunDir = checkpoint.Dir
+	}
+	if err := h.Save(*flagHistory); err != nil {
+		LogPrintln("[E]", L("保存历史记录错误:"), err)
+		return
+	}
+	LogPrintln("[T]", L("历史记录保存在"), filepath.Join(*flagHistory, h.ID+".json"))
+}
+
+// saveReports 把测试报告写入命令行指定的文件
+func saveReports(cli *Client, suite *TestSuite, start time.Time, checkpoint *Checkpoint, interrupted string) {
+	if *flagReportJSON != "" {
+		r := NewJSONReport(cli, suite, *flagFile, start, interrupted)
+		if checkpoint != nil {
+			r.RunDir = checkpoint.Dir
+		}
+		if err := r.Save(*flagReportJSON); err != nil {
+			LogPrintln("[E]", L("保存JSON报告错误:"), err)
+		} else {
+			LogPrintln("[T]", L("JSON报告保存在"), *flagReportJSON)
+		}
+	}
+	if *flagReportJUnit != "" {
+		if err := SaveJUnitReport(*flagReportJUnit, cli, suite, start, interrupted); err != nil {
+			LogPrintln("[E]", L("保存JUnit报告错误:"), err)
+		} else {
+			LogPrintln("[T]", L("JUnit报告保存在"), *flagReportJUnit)
+		}
+	}
+	if *flagReportHTML != "" {
+		if err := SaveHTMLReport(*flagReportHTML, cli, suite, interrupted); err != nil {
+			LogPrintln("[E]", L("保存HTML报告错误:"), err)
+		} else {
+			LogPrintln("[T]", L("HTML报告保存在"), *flagReportHTML)
+		}
+	}
+	if *flagReportDocx != "" {
+		if err := SaveDocxReport(*flagReportDocx, cli, suite, interrupted); err != nil {
+			LogPrintln("[E]", L("保存Word报告错误:"), err)
+		} else {
+			LogPrintln("[T]", L("Word报告保存在"), *flagReportDocx)
+		}
+	}
+}
+
+// signReports 把控制台报告保存到运行目录，有签名私钥时生成签名清单
+func signReports(cli *Client, checkpoint *Checkpoint, text string) {
+	if checkpoint == nil {
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(checkpoint.Dir, reportTextName), []byte(text), 0644); err != nil {
+		LogPrintln("[E]", L("保存报告错误:"), err)
+		return
+	}
+	if Signer == nil {
+		return
 	}
-	defer l.Close()
-	LogPrintln("[I]", "Listening on "+*flagHost+":"+*flagPort)
+	files := []string{*flagReportJSON, *flagReportJUnit, *flagReportHTML, *flagReportDocx, *flagLogFile}
+	if err := Signer.SignRunDir(checkpoint.Dir, cli.Info(), files); err != nil {
+		LogPrintln("[E]", L("签名报告错误:"), err)
+		return
+	}
+	LogPrintln("[T]", fmt.Sprintf(L("签名清单保存在 %s，可以用 verify -pubkey 公钥文件 %s 校验"), filepath.Join(checkpoint.Dir, manifestName), checkpoint.Dir))
+}
+
+// runLoad 执行负载测试并输出报告，返回进程退出码
+func runLoad(cli *Client, opts LoadOptions, runner *Runner) int {
+	// 请求组合中可能有修改配置的请求
+	if *flagSnapshot {
+		LogPrintln("[T]", L("保存设备配置"))
+		runner.holdSnapshot(TakeSnapshot(cli))
+	}
+	load := NewLoad(cli, opts, runner.Done())
+	load.Run()
+	runner.restoreSnapshot()
+
+	load.PrintReport(runner.Interrupted())
+	switch {
+	case runner.Interrupted() != "":
+		return ExitInterrupted
+	case !load.Passed():
+		return ExitFail
+	}
+	return ExitPass
+}
+
+// listSuite 打印筛选后的测试队列
+func listSuite(suite *TestSuite) {
+	for _, v := range suite.Setup {
+		fmt.Println(L("准备步骤:"), v.Name)
+	}
+	fmt.Println(FW(L("序号"), 4), "|", FW(L("测试接口名称"), 40), "|", FW(L("测试用例名称"), 34), "|", L("标签"))
+	for i, v := range suite.Items {
+		fmt.Println(fmt.Sprintf("%4v", i+1), "|", FW(v.Interface, 40), "|", FW(v.Name, 34), "|", strings.Join(v.Tags, ","))
+	}
+	for _, v := range suite.Teardown {
+		fmt.Println(L("清理步骤:"), v.Name)
+	}
+	fmt.Println(fmt.Sprintf(L("共 %d 项"), len(suite.Items)))
+}
+
+func handleListen(l net.Listener, cli *Client, shutdown <-chan struct{}) {
+	LogPrintln("[I]", "Listening on "+l.Addr().String())
 
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			LogPrintln("[E]", "Error accepting: ", err)
-			os.Exit(1)
+			select {
+			case <-shutdown:
+			default:
+				LogPrintln("[E]", "Error accepting: ", err)
+			}
+			return
 		}
 
 		// logs an incoming message
-		LogPrintln("[E]", "Connection", conn.RemoteAddr(), "->", conn.LocalAddr())
+		LogPrintln("[I]", "Connection", conn.RemoteAddr(), "->", conn.LocalAddr())
 		cli.Run(conn)
 	}
 }
@@ -0,0 +1,495 @@
+package main
+
+// messagesEN 是英文的消息目录，键是代码中的中文原文
+var messagesEN = map[string]string{
+	usageCommands: `Commands:
+  run      connect to the device under test and run the test queue (default)
+  list     only list the filtered test queue, without listening
+  console  interactive console to send and receive e-Link messages by hand after the device connects
+  serve    only start listening and the HTTP control interface, tests are started from the web page or HTTP requests
+  soak     run the test queue repeatedly and print a stability test report
+  load     send requests at a rate or concurrency and print a control plane load test report
+  coverage show how the test queue covers the Q/CT2621-2017 tables and get_status names
+  compare  compare the history of two software versions of one model, e.g. compare V1.0 V1.1, lists the history without versions
+  verify   verify the manifest signature and file SHA-256 of a run directory, e.g. verify -pubkey lab.pub runs/20060102-150405
+`,
+
+	// 动作
+	"执行动作:":   "Action:",
+	"执行动作失败:": "Action failed:",
+	"动作输出:":   "Action output:",
+	"动作结果: 退出码 %v，花费 %v 秒": "Action result: exit code %v, took %v s",
+	"执行动作超过 %d 秒，已终止":      "Action ran longer than %d s and was killed",
+
+	// 运行目录
+	"创建测试记录文件错误:": "Error creating transcript file:",
+	"保存测试结果错误:":   "Error saving test result:",
+	"保存设备配置错误:":   "Error saving device configuration:",
+
+	// 设备连接
+	"设备注册的MAC地址无效，拒绝注册:": "Invalid MAC address in device registration, rejected:",
+
+	// 控制台
+	"输入help查看命令，Tab补全，quit退出": "Type help for commands, Tab to complete, quit to exit",
+	"匹配成功:": "Matched:",
+	"匹配超时:": "Match timed out:",
+	"设备尚未注册，消息将在注册后发送": "Device not registered yet, the message will be sent after registration",
+	"无效的请求:": "Invalid request:",
+	"{...}                  直接发送JSON消息，sequence缺省时自动分配": "{...}                  send a JSON message as is, sequence is assigned if missing",
+	"未知命令: %s，输入help查看命令":                               "Unknown command: %s, type help for commands",
+	"用法:":    "Usage:",
+	"连接状态:":  "Connection state:",
+	"连接次数:":  "Connections:",
+	"已协商密钥:": "Key negotiated:",
+
+	// 规范覆盖情况
+	"%s %d, %s %d, %s %d，共 %d 个表": "%s %d, %s %d, %s %d, %d tables in total",
+	"Q/CT2621-2017 规范覆盖情况":        "Q/CT2621-2017 specification coverage",
+	"表号":                          "Table",
+	"名称":                          "Title",
+	"状态":                          "Status",
+	"测试数":                         "Tests",
+	"没有测试的项目":                     "Items without tests",
+	"没有测试的get_status名称：":          "get_status names without tests:",
+	"不在规范目录中的表号：":                 "Tables not in the specification catalog:",
+	"覆盖统计：":                       "Coverage:",
+
+	// 设备信息和DHCP租约
+	"查询设备能力":          "Querying device capabilities",
+	"设备能力:":           "Device capability:",
+	"查询设备能力失败:":       "Failed to query device capability:",
+	" 网关 %s":          " gateway %s",
+	" 租期 %d 秒，分配于 %s": " lease %d s, assigned at %s",
+	"DHCP分配地址:":       "DHCP address assigned:",
+	"无（本次运行没有为设备分配地址）": "none (no address was assigned to the device in this run)",
+	"厂商":     "Vendor",
+	"型号":     "Model",
+	"MAC地址":  "MAC address",
+	"软件版本":   "Software version",
+	"硬件版本":   "Hardware version",
+	"序列号":    "Serial number",
+	"IP地址":   "IP address",
+	"无线":     "Wireless",
+	"支持频段":   "Supported bands",
+	"工作模式":   "Work mode",
+	"组网类型":   "Network type",
+	"DHCP租约": "DHCP lease",
+
+	// Word报告
+	"e-Link自组网接口一致性测试报告": "e-Link Ad Hoc Network Interface Conformance Test Report",
+	"测试依据":          "Standard",
+	"委托单位":          "Client",
+	"测试地点":          "Location",
+	"测试时间":          "Test time",
+	"版 本 号":         "Version",
+	"测试人员":          "Tester",
+	"连接次数":          "Connections",
+	"测试中断":          "Interrupted",
+	"（部分结果）":        " (partial results)",
+	"结果统计":          "Summary",
+	"签名指纹":          "Signature fingerprint",
+	"一、设备信息":        "1. Device Information",
+	"二、测试结果":        "2. Test Results",
+	"序号":            "No.",
+	"测试接口名称":        "Interface",
+	"测试用例名称":        "Test case",
+	"测试结果":          "Result",
+	"三、规范覆盖情况":      "3. Specification Coverage",
+	"附录  消息记录":      "Appendix  Message Transcripts",
+	"%d. %s（%v）":    "%d. %s (%v)",
+	"跳过原因: ":        "Skip reason: ",
+	"动作: %s，退出码 %d": "Action: %s, exit code %d",
+
+	// 历史记录
+	"忽略无效的历史记录:": "Ignoring invalid history record:",
+	"开始时间":       "Start time",
+	"共 %d 次测试":   "%d runs in total",
+	"读取历史记录错误:":  "Error reading history:",
+	"用法: compare [-model 型号] <旧版本> <新版本>":        "Usage: compare [-model MODEL] <old version> <new version>",
+	"没有找到唯一的型号同时有版本 %s 和 %s 的测试记录，可以用-model指定型号": "No unique model has test records for both version %s and %s, use -model to choose the model",
+	"版本 %s 没有完整的测试记录":                            "Version %s has no complete test record",
+	"型号:":                                        "Model:",
+	"旧版本: %s，%s，共 %d 次测试":                        "Old version: %s, %s, %d runs in total",
+	"新版本: %s，%s，共 %d 次测试":                        "New version: %s, %s, %d runs in total",
+	"回归（旧版本通过，新版本不通过）":                           "Regressions (passed in old version, failed in new version)",
+	"修复（旧版本不通过，新版本通过）":                           "Fixes (failed in old version, passed in new version)",
+	"新增的测试":                                      "Added tests",
+	"删除的测试":                                      "Removed tests",
+	"不稳定的测试":                                     "Flaky tests",
+	"通过 %d，不通过 %d，重试后通过 %d":                      "passed %d, failed %d, passed after retry %d",
+
+	// HTML报告
+	"其他":              "Other",
+	"设备信息":            "Device Information",
+	"各接口通过率":          "Pass Rate by Interface",
+	"通过率":             "Pass rate",
+	"通过/执行":           "Passed/Run",
+	"，预期失败 %d":        ", expected failures %d",
+	"规范覆盖情况":          "Specification Coverage",
+	"执行次数: %d，用时: %s": "Attempts: %d, duration: %s",
+	"预期失败: ":          "Expected failure: ",
+	"关键词 ":            "Keyword ",
+	"已匹配":             "matched",
+	"未匹配":             "not matched",
+
+	// HTTP控制接口和网页仪表盘
+	"HTTP控制接口":                "HTTP control interface",
+	"缺少或错误的访问令牌":              "Missing or wrong access token",
+	"请求内容必须是application/json": "The request body must be application/json",
+	"测试队列文件只能是测试队列目录中的相对路径":   "The test queue file must be a relative path in the test queue directory",
+	"网页模板错误:":                 "Web page template error:",
+	"解析TestQueue错误：":          "Error parsing TestQueue:",
+	"测试正在执行":                  "A test run is in progress",
+	"HTTP请求执行测试队列 %s，共 %d 项":  "HTTP request to run test queue %s, %d items in total",
+	"没有正在执行的测试":               "No test is running",
+	"HTTP请求停止":                "Stopped by HTTP request",
+	"缺少type字段":                "Missing type field",
+	"设备尚未注册":                  "Device not registered yet",
+	"测试正在执行，不能发送消息":           "A test is running, messages cannot be sent",
+	"没有等待确认的人工步骤":             "No manual step is waiting for confirmation",
+	"只支持POST":                 "Only POST is supported",
+	"e-Link 测试台":              "e-Link Test Bench",
+	"确认":                      "Confirm",
+	"文件":                      "File",
+	"标签":                      "Tags",
+	"开始":                      "Start",
+	"停止":                      "Stop",
+	"发送":                      "Send",
+	"状态: ":                    "State: ",
+	" 连接次数: ":                 " Connections: ",
+	" 厂商: ":                   " Vendor: ",
+	" 型号: ":                   " Model: ",
+	" 软件版本: ":                 " Software version: ",
+	" 硬件版本: ":                 " Hardware version: ",
+	"执行中 ":                    "Running ",
+	" 中断: ":                   " Interrupted: ",
+	"执行中":                     "Running",
+
+	// JUnit报告
+	"跳过: ":         "Skipped: ",
+	"未执行":          "Not run",
+	"预期失败的测试通过了: ": "Expected failure passed: ",
+
+	// 负载测试
+	"无效的发送速率: %v，可以是0到%d":             "invalid rate: %v, must be between 0 and %d",
+	"-rate为0时-concurrency必须大于0，当前为%d": "-concurrency must be greater than 0 when -rate is 0, got %d",
+	"无效的权重: %s":                       "invalid weight: %s",
+	"无效的用例文件: %s":                     "invalid test case file: %s",
+	"无效的请求: %s":                       "invalid request: %s",
+	"请求组合为空":                          "request mix is empty",
+	"负载测试:":                           "Load test:",
+	"每秒 %v 个请求，持续 %v":                 "%v requests per second for %v",
+	"并发 %v 个请求，持续 %v":                 "%v concurrent requests for %v",
+	"e-Link控制面负载测试报告":                 "e-Link Control Plane Load Test Report",
+	"发送方式：":                           "Sending:",
+	"每秒 %v 个请求":                       "%v requests per second",
+	"并发 %v 个请求":                       "%v concurrent requests",
+	"测试时长：":                           "Duration:",
+	"测试中断：%s（部分结果）":                   "Interrupted: %s (partial results)",
+	"请求数量：%d，应答数量：%d":                 "Requests: %d, responses: %d",
+	"吞 吐 量：%.1f 个/秒":                  "Throughput: %.1f req/s",
+	"超时请求：%d，其中迟到 %d，丢失 %d":           "Timeouts: %d, late %d, lost %d",
+	"应答时间：p50 %s，p95 %s，p99 %s":       "Latency: p50 %s, p95 %s, p99 %s",
+	"请求":   "Request",
+	"权重":   "Wt",
+	"  发送": "  Sent",
+	"  应答": "  Recv",
+	"  超时": " T/out",
+	"设备心跳：%d 次，最长间隔 %v": "Keepalives: %d, max gap %v",
+	"主动上报：%s %d 次":      "Reports: %s %d times",
+	"断线次数：":             "Disconnects:",
+	"测试结论：":             "Conclusion:",
+	"负载期间设备断线":          "device disconnected during the load",
+	"负载期间设备心跳中断":        "device keepalives stopped during the load",
+	"有 %d 个请求没有及时应答":    "%d requests were not answered in time",
+	"全部请求及时应答":          "all requests answered in time",
+
+	// 日志
+	"提示期间的日志过多，丢弃了最早的 %d 条":   "Too many log entries during the prompt, dropped the oldest %d",
+	"无效的日志格式: %s，可以是 %s 或 %s": "Invalid log format: %s, can be %s or %s",
+	"无效的日志级别: %s，可以是 %v":      "Invalid log level: %s, can be %v",
+
+	// 命令行参数和运行日志
+	"侦听地址":       "listen address",
+	"侦听端口":       "listen port",
+	"测试队列文件名":    "test queue file name",
+	"测试手机的MAC地址": "MAC address of the test phone",
+	"追加日志的文件名，缺省只输出到标准输出和标准错误":                                             "Name of the log file to append to. Default: stdout/stderr only",
+	"不输出日志到标准输出和标准错误":                                                      "Disable logging to stdout/stderr",
+	"日志级别，可以是 %v":                                                          "Log level. One of %v",
+	"日志格式：text 文本，json 每行一个JSON对象":                                         "log format: text, or json for one JSON object per line",
+	"DHCP服务器的配置文件":                                                         "DHCP server configuration file",
+	"列出DHCP插件":                                                             "list DHCP plugins",
+	"测试前保存设备配置，测试后自动恢复":                                                    "save the device configuration before testing and restore it afterwards",
+	"只执行带有这些标签的测试用例，多个标签用逗号分隔":                                             "only run test cases with these tags, comma separated",
+	"跳过带有这些标签的测试用例，多个标签用逗号分隔":                                              "skip test cases with these tags, comma separated",
+	"只执行名称匹配这些通配符的测试用例，如 \"*LED*,CPURate.elk\"":                            "only run test cases whose names match these wildcards, e.g. \"*LED*,CPURate.elk\"",
+	"跳过名称匹配这些通配符的测试用例，如 \"*_manual.elk\"":                                  "skip test cases whose names match these wildcards, e.g. \"*_manual.elk\"",
+	"只执行这些接口表的测试用例，如 \"表10,表21\"":                                          "only run test cases of these interface tables, e.g. \"表10,表21\"",
+	"无人值守，不等待人工确认，标准输入不是终端时自动启用":                                           "unattended, do not wait for manual confirmation; enabled automatically when stdin is not a terminal",
+	"无人值守或提示超时时对人工步骤的处理：skip 跳过，confirm 自动确认":                              "how manual steps are handled when unattended or when a prompt times out: skip or confirm",
+	"人工提示的等待秒数，0表示一直等待":                                                    "seconds to wait at manual prompts, 0 waits forever",
+	"^Action^命令的最长执行秒数，超时后终止命令，0表示不限时":                                     "maximum seconds an ^Action^ command may run before it is killed, 0 means no limit",
+	"测试总时间秒数，超时后停止测试，0表示不限制":                                               "total test time in seconds, stops the tests when exceeded, 0 for no limit",
+	"等待设备连接并完成注册的秒数，0表示一直等待":                                               "seconds to wait for the device to connect and register, 0 waits forever",
+	"soak命令重复执行测试队列的轮数，0表示不限制":                                             "number of iterations of the soak command, 0 for no limit",
+	"soak命令重复执行测试队列的时长，如 8h，0表示不限制；load命令缺省为1m":                            "duration of the soak command, e.g. 8h, 0 for no limit; the load command defaults to 1m",
+	"load命令每秒发送的请求数，0表示按-concurrency并发发送":                                  "requests per second of the load command, 0 sends -concurrency requests concurrently",
+	"load命令同时等待应答的请求数":                                                     "number of outstanding requests of the load command",
+	"load命令的请求组合，get_status名称或用例文件，冒号后是权重，如 \"cpurate:3,LEDSwitchON.elk\"": "request mix of the load command, get_status names or test case files with an optional weight after a colon, e.g. \"cpurate:3,LEDSwitchON.elk\"",
+	"保存每个测试的结果和记录的目录，缺省为 runs/开始时间":                                        "directory for the result and transcript of each test, default runs/<start time>",
+	"从运行目录继续中断的测试，跳过已完成的测试":                                                "resume an interrupted run from its run directory, skipping completed tests",
+	"全屏显示测试队列、当前测试、设备信息和消息日志":                                              "full screen view of the test queue, current test, device information and message log",
+	"HTTP控制接口和网页仪表盘的侦听地址，如 \":8080\"只侦听本机，\"0.0.0.0:8080\"侦听全部网卡，缺省不启用":    "listen address of the HTTP control interface and web dashboard, \":8080\" listens on this host only, \"0.0.0.0:8080\" on all interfaces, disabled by default",
+	"HTTP控制接口的访问令牌，缺省每次启动时随机生成并输出在日志中":                                     "access token of the HTTP control interface, by default a random token is generated at startup and written to the log",
+	"报告配置文件，设置报告头的信息和报告模板，缺省文件不存在时使用内置的信息和模板":                              "report configuration file with report header information and templates; built-in values are used if the default file does not exist",
+	"修改报告头的信息，如 \"client=某某公司,location=3号实验室,委托单号=WQ-001\"，standard/client/location/version/tester/transcripts以外的名称作为自定义项目": "override report header information, e.g. \"client=ACME,location=Lab 3,order=WQ-001\"; names other than standard/client/location/version/tester/transcripts become custom fields",
+	"测试结束后把包含设备信息、请求、收到的消息和关键词匹配情况的报告写入这个JSON文件":                                                                            "write a JSON report with device information, requests, received messages and keyword matches to this file",
+	"测试结束后把JUnit XML格式的报告写入这个文件，供CI系统读取":                                                                                    "write a JUnit XML report to this file for CI systems",
+	"测试结束后把不依赖外部资源的HTML报告写入这个文件":                                                                                            "write a self-contained HTML report to this file",
+	"测试结束后把Word格式的一致性测试报告写入这个.docx文件":                                                                                       "write a Word conformance report to this .docx file",
+	"覆盖率统计使用的规范目录JSON文件，缺省使用内置的Q/CT2621-2017目录":                                                                             "specification catalog JSON file for coverage, default is the built-in Q/CT2621-2017 catalog",
+	"保存每次测试结果的历史记录目录，为空时不保存":                                                                                                "history directory for the results of each run, empty to disable",
+	"compare命令比较的设备型号，缺省为两个版本都有记录的型号":                                                                                       "device model for the compare command, default is the model with records for both versions",
+	"测试结束后用这个PEM格式的Ed25519私钥签名运行目录中的报告、测试记录和日志的SHA-256清单":                                                                   "sign the SHA-256 manifest of reports, transcripts and logs in the run directory with this PEM Ed25519 private key",
+	"verify命令使用的PEM格式的Ed25519公钥，缺省使用清单中的公钥":                                                                                 "PEM Ed25519 public key for the verify command, default is the key in the manifest",
+	"日志、提示和报告的语言，zh-CN或en，缺省使用ELINKS_LANG环境变量，没有设置时为zh-CN":                                                                  "language of logs, prompts and reports, zh-CN or en; defaults to the ELINKS_LANG environment variable, or zh-CN",
+	"用法: verify [-pubkey 公钥文件] <运行目录>":                                                                                      "Usage: verify [-pubkey PUBLIC_KEY] <run directory>",
+	"设置日志错误:":   "Error setting up logging:",
+	"读取报告配置错误:": "Error reading report configuration:",
+	"报告配置中没有设置%s，报告中这一项为空，可以在%s中设置或用-report-set %s=...指定": "%s is not set in the report configuration and is left empty in the reports, set it in %s or with -report-set %s=...",
+	"读取签名私钥错误:":            "Error reading signing key:",
+	"报告签名公钥指纹":             "Report signing key fingerprint",
+	"不能继续测试:":              "Cannot resume:",
+	"继续测试 %s，已完成 %d 项":     "Resuming %s, %d items completed",
+	"读取规范目录错误:":            "Error reading specification catalog:",
+	"无效的测试手机MAC地址[":        "Invalid test phone MAC address [",
+	"serve命令需要指定-http侦听地址": "The serve command requires an -http listen address",
+	"保存覆盖情况错误:":            "Error saving coverage:",
+	"覆盖情况保存在":              "Coverage saved in",
+	"创建运行目录错误:":            "Error creating run directory:",
+	"测试结果保存在 %[1]s，中断后可以用 -resume %[1]s 继续": "Results are saved in %[1]s, after an interruption use -resume %[1]s to continue",
+	"无效的负载测试参数:":                            "Invalid load test parameters:",
+	"无效的人工步骤处理策略[":                          "Invalid manual step policy [",
+	"标准输入不是终端，启用无人值守模式":                     "Standard input is not a terminal, running unattended",
+	"读取DHCP配置错误:":                           "Error loading DHCP configuration:",
+	"注册DHCP插件错误:":                           "Error registering DHCP plugin:",
+	"启动DHCP服务错误:":                           "Error starting DHCP server:",
+	"HTTP控制接口错误:":                           "HTTP control interface error:",
+	"HTTP控制接口错误 ":                           "HTTP control interface error ",
+	"不能启用全屏界面:":                             "Cannot start full screen interface:",
+	"收到信号 %v，停止测试，再次按Ctrl+C立即退出":            "Received signal %v, stopping the tests, press Ctrl+C again to exit immediately",
+	"收到信号 ":                                 "Received signal ",
+	"再次收到信号，立即退出":                           "Received signal again, exiting immediately",
+	"测试总时间超过 %d 秒，停止测试":                     "Total test time exceeded %d seconds, stopping the tests",
+	"测试总时间超过 %d 秒":                          "Total test time exceeded %d seconds",
+	"等待设备连接时中断:":                            "Interrupted while waiting for the device:",
+	"等待设备连接超时: %d 秒":                        "Timed out waiting for the device to connect: %d seconds",
+	"保存历史记录错误:":                             "Error saving history:",
+	"历史记录保存在":                               "History saved in",
+	"保存JSON报告错误:":                           "Error saving JSON report:",
+	"JSON报告保存在":                             "JSON report saved in",
+	"保存JUnit报告错误:":                          "Error saving JUnit report:",
+	"JUnit报告保存在":                            "JUnit report saved in",
+	"保存HTML报告错误:":                           "Error saving HTML report:",
+	"HTML报告保存在":                             "HTML report saved in",
+	"保存Word报告错误:":                           "Error saving Word report:",
+	"Word报告保存在":                             "Word report saved in",
+	"保存报告错误:":                               "Error saving report:",
+	"签名报告错误:":                               "Error signing reports:",
+	"签名清单保存在 %s，可以用 verify -pubkey 公钥文件 %s 校验": "Signed manifest saved to %s, verify it with verify -pubkey <public key file> %s",
+	"保存设备配置": "Saving device configuration",
+	"准备步骤:":  "Setup step:",
+	"清理步骤:":  "Teardown step:",
+	"共 %d 项": "%d items in total",
+
+	// 人工提示
+	"\r--- 剩余 %3d 秒 >>>>>>>> ": "\r--- %3d s left >>>>>>>> ",
+
+	// 测试队列
+	"参数名为空":               "empty parameter name",
+	"参数 %s 有空的取值":         "parameter %s has an empty value",
+	"参数 %s 的范围 %s 起点大于终点": "parameter %s: range %s starts after it ends",
+	"参数 %s 没有取值":          "parameter %s has no values",
+	"参数 %s 重复定义":          "parameter %s is defined more than once",
+	"无效的测试参数:":            "Invalid test parameter:",
+
+	// 控制台报告
+	"报告模板错误:": "Report template error:",
+	"测试记录: ":  "Transcript: ",
+	"测试依据：":   "Standard:",
+	"委托单位：":   "Client:",
+	"测试地点：":   "Location:",
+	"测试时间：":   "Test time:",
+	"版 本 号：":  "Version:",
+	"测试人员：":   "Tester:",
+	"：":       ":",
+	"连接次数：":   "Connections:",
+	"测试中断：":   "Interrupted:",
+	"设备信息：":   "Device information:",
+	"结果统计：":   "Summary:",
+
+	// 报告配置
+	"《中国电信家庭终端与智能家庭网关自动连接的接口技术要求》(Q/CT2621-2017)": "China Telecom Interface Technical Requirements for Automatic Connection between Home Terminals and Smart Home Gateways (Q/CT2621-2017)",
+	"无效的transcripts: %s，可以是none、failed或all":       "invalid transcripts: %s, must be none, failed or all",
+
+	// 测试执行
+	"使用运行目录中保存的设备配置":  "Using the device configuration saved in the run directory",
+	"测试队列准备失败，跳过全部测试": "Test queue setup failed, skipping all tests",
+	"测试中断: %s，跳过剩余测试": "Interrupted: %s, skipping remaining tests",
+	"已经完成:":           "Already completed:",
+	"恢复设备配置":          "Restoring device configuration",
+	"设备配置没有恢复完成，可以用 -resume %s 继续测试，结束后恢复保存的配置": "The device configuration was not fully restored; run with -resume %s to continue the tests and restore the saved configuration at the end",
+	"设备配置没有恢复完成，设备可能保留了测试中修改的配置":                "The device configuration was not fully restored; the device may keep settings changed by the tests",
+	"失败":          "failed",
+	"测试名称:":       "Test name:",
+	"接口名称:":       "Interface:",
+	"超时时间: %d 秒":  "Timeout: %d seconds",
+	"词语匹配:":       "Keywords:",
+	"无人值守，跳过人工步骤": "unattended, manual step skipped",
+	"跳过原因:":       "Skip reason:",
+	"测试结果:":       "Result:",
+	"等待重试: %d 秒":  "Retrying in: %d seconds",
+	"重试次数:":       "Retry:",
+	"人工步骤未确认":     "manual step not confirmed",
+	"预期失败:":       "Expected failure:",
+	"测试被停止，结果不保存": "The test was stopped, its result is not saved",
+	"按回车键继续":      "Press Enter to continue",
+	"等待超时":        "Timed out",
+	"标准输入已关闭，启用无人值守模式": "Standard input closed, running unattended",
+	"自动确认":       "Confirmed automatically",
+	"打印开始:":      "Output begin:",
+	"打印结束:":      "Output end:",
+	"花费时间: %v 秒": "Elapsed: %v seconds",
+
+	// 报告签名
+	"不是PEM格式的私钥":                "not a PEM private key",
+	"不是Ed25519私钥: %T":           "not an Ed25519 private key: %T",
+	"不是PEM格式的公钥":                "not a PEM public key",
+	"不是Ed25519公钥: %T":           "not an Ed25519 public key: %T",
+	"%s 和 %s 的文件名相同，不能都复制到运行目录": "%s and %s have the same file name and cannot both be copied into the run directory",
+	"读取签名清单错误:":                 "Error reading manifest:",
+	"读取签名错误:":                   "Error reading signature:",
+	"无效的签名清单:":                  "Invalid manifest:",
+	"读取公钥错误:":                   "Error reading public key:",
+	"清单中的公钥无效":                  "Invalid public key in the manifest",
+	"没有指定-pubkey，使用清单中的公钥，请确认指纹 %s 是实验室的公钥": "-pubkey not given, using the public key in the manifest; make sure fingerprint %s belongs to your lab",
+	"运行目录:":  "Run directory:",
+	"签名时间:":  "Signed at:",
+	"设备:":    "Device:",
+	"公钥指纹:":  "Key fingerprint:",
+	"签名: 无效": "Signature: INVALID",
+	"签名: 有效": "Signature: valid",
+	"错误":     "ERROR",
+	"修改":     "MODIFIED",
+	"正确":     "OK",
+	"多余":     "EXTRA",
+	"校验失败，报告或记录被修改过": "Verification failed, reports or records have been modified",
+	"只校验了完整性：%d 个文件没有被修改，但没有用-pubkey指定可信的公钥，签名者未验证": "Integrity only: %d files are unmodified, but no trusted key was given with -pubkey, so the signer is unverified",
+	"校验通过，共 %d 个文件": "Verification passed, %d files",
+
+	// 设备配置
+	"保存配置:":   "Saving configuration:",
+	"保存配置失败:": "Failed to save configuration:",
+	"恢复配置:":   "Restoring configuration:",
+	"恢复配置失败:": "Failed to restore configuration:",
+
+	// 稳定性测试
+	"稳定性测试中断:":             "Soak test interrupted:",
+	"等待设备重新连接超过 %d 秒":      "Waited for the device to reconnect for more than %d seconds",
+	"稳定性测试第 %d 轮":          "Soak test iteration %d",
+	"第 %d 轮结果: %s，用时 %v":   "Iteration %d result: %s, took %v",
+	"e-Link稳定性测试报告":        "e-Link Stability Test Report",
+	"开始时间：":                "Start time:",
+	"执行轮数：":                "Iterations:",
+	"轮次":                   "Iter",
+	"用时":                   "Duration",
+	"平均应答":                 "Avg resp",
+	"心跳间隔(平均/最大)":          "Keepalive gap (avg/max)",
+	"%s 断开，没有恢复":           "%s disconnected, not recovered",
+	"%s 断开，%s 恢复，间隔 %v":    "%s disconnected, %s recovered, after %v",
+	"应答时间：":                "Latency:",
+	"第1轮 %s ，第 %d 轮 %s":    "iteration 1 %s, iteration %d %s",
+	"，变化 %+.1f%%":          ", change %+.1f%%",
+	"首次失败：":                "First failure:",
+	"第 %d 轮，不通过 %d / %d 轮": "iteration %d, failed in %d / %d iterations",
+	"从第 %d 轮开始出现不通过的测试":    "tests started failing at iteration %d",
+	"全部轮次通过":               "all iterations passed",
+
+	// 消息记录
+	"动作: %s 退出码 %d":     "Action: %s exit code %d",
+	"发送请求":              "Request sent",
+	"收到消息（匹配应答关键词）":     "Message received (matches the response keywords)",
+	"收到消息":              "Message received",
+	"动作执行失败，退出码 %d: %s": "Action failed with exit code %d: %s",
+	"没有发送请求，准备步骤失败或者没有执行记录":       "No request was sent, setup failed or there is no record",
+	"%d 秒内没有收到消息":                 "%d seconds passed without any message",
+	"收到 %d 条消息，没有匹配的关键词: %s":      "Received %d messages, keywords not matched: %s",
+	"收到 %d 条消息，没有一条同时包含全部关键词: %s": "Received %d messages, none contains all keywords: %s",
+
+	// 全屏界面
+	"标准输入输出不是终端":                             "standard input and output are not a terminal",
+	"收到停止按键，停止测试，再次按q立即退出":                   "Stop key pressed, stopping the tests, press q again to exit immediately",
+	"收到停止按键":                                 "stop key pressed",
+	"再次收到停止按键，立即退出":                          "Stop key pressed again, exiting immediately",
+	"终端窗口太小，至少需要60列20行":                      "Terminal too small, at least 60 columns and 20 rows are needed",
+	" e-Link 自组网接口一致性测试  %s  已用时 %v":         " e-Link Ad Hoc Network Interface Conformance Test  %s  elapsed %v",
+	" Enter 确认人工步骤   q/Ctrl+C 停止测试，再按一次立即退出": " Enter confirm manual step   q/Ctrl+C stop the tests, press again to exit immediately",
+	" 正在停止: ":    " Stopping: ",
+	"测试队列 %d/%d": "Test queue %d/%d",
+	"当前测试":       "Current test",
+	"测试名称: ":     "Test name: ",
+	"接口名称: ":     "Interface: ",
+	"词语匹配: %v  超时时间: %d 秒  重试次数: %d": "Keywords: %v  Timeout: %d s  Retries: %d",
+	"执行动作: ":             "Action: ",
+	"人工步骤: ":             "Manual step: ",
+	"等待确认，按回车键继续":        "Waiting for confirmation, press Enter to continue",
+	"  剩余 %d 秒":          "  remaining %d s",
+	"等待应答: 剩余 %d 秒":      "Waiting for response: remaining %d s",
+	"等待设备连接并完成注册...":     "Waiting for the device to connect and register...",
+	"连接状态: %s  连接次数: %d": "State: %s  Connections: %d",
+	"厂商型号: ":             "Vendor/model: ",
+	"软件版本: ":             "Software: ",
+	"硬件版本: ":             "Hardware: ",
+	"序 列 号: ":            "Serial no.: ",
+	"IP地址:   ":           "IP address: ",
+	"消息日志":               "Message log",
+
+	// 包级变量中的消息：测试结论、连接状态、覆盖状态、规范目录的表名和控制台命令
+	"%s 公司 %s 产品":            "%s %s ",
+	"不支持的语言: %s，可以是zh-CN或en": "unsupported language: %s, must be zh-CN or en",
+	"通过":        "Pass",
+	"重试后通过":     "Pass after retry",
+	"不通过":       "Fail",
+	"预期失败":      "Expected failure",
+	"意外通过":      "Unexpected pass",
+	"跳过":        "Skipped",
+	"未连接":       "Disconnected",
+	"TCP已连接":    "TCP connected",
+	"e-Link已注册": "e-Link registered",
+	"已覆盖":       "Covered",
+	"部分覆盖":      "Partial",
+	"未覆盖":       "None",
+	"配置与同步信息":   "Config and sync",
+	"配置信息":      "Configuration",
+	"查询信息":      "Status query",
+	"下挂设备状态信息":  "Attached devices",
+	"WPS开关消息":   "WPS switch",
+	"设备升级消息":    "Device upgrade",
+	"设备操作信息":    "Device operation",
+	"漫游配置":      "Roaming config",
+	"终端RSSI上报":  "Station RSSI",
+	"下挂终端去关联":   "Deassociation",
+	"无线信号检测":    "Signal detection",
+	"信息返回":      "Information return",
+	"get <name>...          查询信息，如 get cpurate":  "get <name>...          query status, e.g. get cpurate",
+	"set led|wifi|wps on|off 设置开关，如 set led off": "set led|wifi|wps on|off set a switch, e.g. set led off",
+	"reboot                 重启设备":                "reboot                 reboot the device",
+	"rssi <mac>             查询终端信号强度":            "rssi <mac>             query the signal strength of a station",
+	"deassoc <mac>          下挂终端去关联":             "deassoc <mac>          deassociate a station",
+	"msg <type> [json]      发送指定类型的消息，json为附加字段": "msg <type> [json]      send a message of the given type, json adds fields",
+	"send <file.elk>        发送用例文件中的请求，并检查匹配词语":  "send <file.elk>        send the request of a test case file and check its keywords",
+	"state                  显示设备连接状态和注册信息":       "state                  show the connection state and registration information",
+	"help                   显示帮助":                "help                   show help",
+	"quit                   退出":                  "quit                   exit",
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 无人值守时对人工步骤的处理策略
+const (
+	ManualSkip    = "skip"    // 跳过需要人工操作的用例
+	ManualConfirm = "confirm" // 视为已经确认，继续执行
+)
+
+var (
+	stdinLines chan string
+	stdinOnce  sync.Once
+)
+
+// 等待中的人工提示可以由HTTP控制接口或全屏界面代替回车确认。
+// PromptRemote为true时，标准输入关闭后仍然等待远程确认；
+// PromptStdin为false时不读取标准输入，倒计时输出到PromptWriter
+var (
+	PromptRemote   bool
+	PromptStdin              = true
+	PromptWriter   io.Writer = os.Stdout
+	promptLocker   sync.Mutex
+	promptMessage  string
+	promptDeadline time.Time
+	promptConfirm  = make(chan struct{})
+)
+
+// PendingPrompt 返回正在等待确认的提示信息，没有时返回空字符串
+func PendingPrompt() string {
+	promptLocker.Lock()
+	defer promptLocker.Unlock()
+	return promptMessage
+}
+
+// PendingPromptDeadline 返回等待中的提示的超时时间，不限时时返回零值
+func PendingPromptDeadline() time.Time {
+	promptLocker.Lock()
+	defer promptLocker.Unlock()
+	return promptDeadline
+}
+
+// ConfirmPrompt 确认正在等待的人工提示，没有等待中的提示时返回false
+func ConfirmPrompt() bool {
+	select {
+	case promptConfirm <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func setPendingPrompt(message string, deadline time.Time) {
+	promptLocker.Lock()
+	promptMessage = message
+	promptDeadline = deadline
+	promptLocker.Unlock()
+}
+
+// 标准输入由一个协程统一读取，提示超时后残留的读操作不会吞掉下一次回车
+func readStdin() <-chan string {
+	stdinOnce.Do(func() {
+		stdinLines = make(chan string)
+		go func() {
+			reader := bufio.NewReader(os.Stdin)
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					close(stdinLines)
+					return
+				}
+				stdinLines <- line
+			}
+		}()
+	})
+	return stdinLines
+}
+
+// IsTerminal 判断标准输入是否为终端
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// WaitEnter的返回值
+const (
+	PromptConfirmed = iota // 操作员已按回车
+	PromptTimeOut          // 等待超时
+	PromptClosed           // 标准输入已关闭，如重定向自/dev/null
+	PromptCanceled         // 测试被停止
+)
+
+// WaitEnter 等待操作员按回车或远程确认，seconds大于0时显示倒计时，cancel关闭时立即返回
+func WaitEnter(message string, seconds int, cancel <-chan struct{}) int {
+	var deadline time.Time
+	if seconds > 0 {
+		deadline = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	setPendingPrompt(message, deadline)
+	defer setPendingPrompt("", time.Time{})
+
+	// 不限时时timeout和tick都是nil，select永远不会选中它们
+	var lines <-chan string
+	if PromptStdin {
+		lines = readStdin()
+	}
+	var timeout, tick <-chan time.Time
+	left := seconds
+	if seconds > 0 {
+		timeout = time.After(time.Duration(seconds) * time.Second)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		defer fmt.Fprintln(PromptWriter)
+		tick = ticker.C
+		fmt.Fprintf(PromptWriter, L("\r--- 剩余 %3d 秒 >>>>>>>> "), left)
+	}
+
+	for {
+		select {
+		case _, ok := <-lines:
+			if ok {
+				return PromptConfirmed
+			}
+			if !PromptRemote {
+				return PromptClosed
+			}
+			lines = nil
+		case <-promptConfirm:
+			return PromptConfirmed
+		case <-timeout:
+			return PromptTimeOut
+		case <-cancel:
+			return PromptCanceled
+		case <-tick:
+			left--
+			fmt.Fprintf(PromptWriter, L("\r--- 剩余 %3d 秒 >>>>>>>> "), left)
+		}
+	}
+}
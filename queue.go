@@ -2,11 +2,16 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // {
@@ -27,23 +32,314 @@ import (
 // ^RecTimeOut^120
 // ^Interface^漫游配置/终端RSSI上报(表18、19)
 // ^MessageBox^请点击OK后在120秒后将下挂设备远离AP。
+// ^Setup^SetLEDSwitchON.elk
+// ^Teardown^SetRSSIconfig.elk
+// ^Tags^manual^destructive
+// ^Retries^2
+// ^RetryDelay^5
+// ^XFail^固件已知问题，漫游上报不及时
+// ^Action^./bench/attenuator.sh 60 ${tmac}
 type TestItem struct {
 	Request         interface{}
 	RecTimeOut      int
 	ResponseKeyWord []string
 	Interface       string
 	MessageBox      string
+	Action          string
 	Name            string
-	Pass            bool
+	Tags            []string
+	Params          map[string]string
+
+	// 失败后的重试次数和首次重试前的等待秒数，之后每次等待时间加倍
+	Retries    int
+	RetryDelay int
+
+	// 预期失败或跳过的原因，非空时生效
+	XFail string
+	Skip  string
+
+	Verdict      Verdict
+	Attempts     int
+	ActionResult *ActionResult
+
+	// 本次执行跳过的原因：^Skip^的原因，或者无人值守时人工步骤被跳过。
+	// 与Skip分开保存，重复执行同一个测试时不会沿用上次的原因
+	SkipReason string
+
+	// 从发送请求到收到匹配应答的时间，没有收到匹配应答时为0
+	Latency time.Duration
+
+	// 最后一次执行时发送的请求和等待应答期间收到的消息、
+	// 每个关键词的匹配情况，以及从发送请求到结束等待的时间
+	Transcript []TranscriptEntry
+	Assertions []Assertion
+	Duration   time.Duration
+
+	// 测试前后执行的准备/清理步骤，步骤本身不计入测试结果
+	Setup    TestQueue
+	Teardown TestQueue
+}
+
+// Assertion 记录一个应答关键词是否在收到的消息中出现过
+type Assertion struct {
+	Keyword string `json:"keyword"`
+	Matched bool   `json:"matched"`
 }
 
 type TestQueue []*TestItem
 
+type Verdict int
+
+const (
+	VerdictNone           Verdict = iota // 未执行
+	VerdictPass                          // 通过
+	VerdictPassAfterRetry                // 重试后通过
+	VerdictFail                          // 不通过
+	VerdictXFail                         // 预期失败
+	VerdictXPass                         // 意外通过
+	VerdictSkip                          // 跳过
+)
+
+var verdictNames = map[Verdict]string{
+	VerdictNone:           "未执行",
+	VerdictPass:           "通过",
+	VerdictPassAfterRetry: "重试后通过",
+	VerdictFail:           "不通过",
+	VerdictXFail:          "预期失败",
+	VerdictXPass:          "意外通过",
+	VerdictSkip:           "跳过",
+}
+
+func (v Verdict) String() string {
+	return L(verdictNames[v])
+}
+
+// verdictClasses 是测试结论在HTML报告和网页中的样式名，不随语言变化
+var verdictClasses = map[Verdict]string{
+	VerdictNone:           "none",
+	VerdictPass:           "pass",
+	VerdictPassAfterRetry: "retried",
+	VerdictFail:           "fail",
+	VerdictXFail:          "xfail",
+	VerdictXPass:          "xpass",
+	VerdictSkip:           "skip",
+}
+
+// Class 返回测试结论的样式名
+func (v Verdict) Class() string {
+	return verdictClasses[v]
+}
+
+// Passed 判断测试结论是否可以接受，预期失败和跳过不算作失败
+func (v Verdict) Passed() bool {
+	return v == VerdictPass || v == VerdictPassAfterRetry || v == VerdictXFail || v == VerdictSkip
+}
+
+// 测试队列文件中除了用逗号分隔的测试用例，还可以有以下指令行：
+// ^Setup^SetWifiSwitchON.elk^SetLEDSwitchON.elk
+// ^Teardown^SetWIFIConfig24G.elk
+type TestSuite struct {
+	Name     string
+	Items    TestQueue
+	Setup    TestQueue
+	Teardown TestQueue
+}
+
+// Clone 复制测试队列，复制出的测试没有执行结果，用于重复执行同一个队列
+func (s *TestSuite) Clone() *TestSuite {
+	c := *s
+	c.Items = make(TestQueue, len(s.Items))
+	for i, v := range s.Items {
+		item := *v
+		item.resetResult()
+		c.Items[i] = &item
+	}
+	return &c
+}
+
+// resetResult 清除测试的执行结果，测试的定义不变
+func (q *TestItem) resetResult() {
+	q.Verdict = VerdictNone
+	q.Attempts = 0
+	q.ActionResult = nil
+	q.SkipReason = ""
+	q.Latency = 0
+	q.Transcript = nil
+	q.Assertions = nil
+	q.Duration = 0
+}
+
 const (
 	STAMAC = "A03BE385997D"
 )
 
-func CreateTestItemFromFile(name string, mac string) *TestItem {
+// 测试参数，^Param^channel^1-13 或 ^Param^auth^wpapsk^wpa2psk
+// 请求、匹配词语、提示信息和动作中的${channel}会被替换为参数值，
+// 多个参数按笛卡尔积展开为多个测试用例
+type TestParam struct {
+	Name   string
+	Values []string
+}
+
+// 解析后尚未代入参数的测试用例文件
+type testTemplate struct {
+	name     string
+	request  string
+	timeout  int
+	keywords []string
+	title    string
+	message  string
+	action   string
+	tags     []string
+	setup    []string
+	teardown []string
+	params   []TestParam
+	retries  int
+	delay    int
+	xfail    string
+	skip     string
+}
+
+var paramRangePattern = regexp.MustCompile(`^([0-9]+)-([0-9]+)$`)
+
+// parseTestParam 解析^Param^之后的部分，参数名或取值为空、范围的起点大于终点时返回错误
+func parseTestParam(s string) (p TestParam, err error) {
+	values := strings.Split(s, "^")
+	p.Name = strings.TrimSpace(values[0])
+	if p.Name == "" {
+		return p, errors.New(L("参数名为空"))
+	}
+	for _, v := range values[1:] {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return p, fmt.Errorf(L("参数 %s 有空的取值"), p.Name)
+		}
+		if m := paramRangePattern.FindStringSubmatch(v); m != nil {
+			from, _ := strconv.Atoi(m[1])
+			to, _ := strconv.Atoi(m[2])
+			if from > to {
+				return p, fmt.Errorf(L("参数 %s 的范围 %s 起点大于终点"), p.Name, v)
+			}
+			for i := from; i <= to; i++ {
+				p.Values = append(p.Values, strconv.Itoa(i))
+			}
+		} else {
+			p.Values = append(p.Values, v)
+		}
+	}
+	if len(p.Values) == 0 {
+		return p, fmt.Errorf(L("参数 %s 没有取值"), p.Name)
+	}
+	return p, nil
+}
+
+func CreateTestItemsFromFile(name string, mac string) (queue TestQueue) {
+	t := parseTestItemFile(name, mac)
+	if t == nil {
+		return
+	}
+
+	for _, values := range t.expand() {
+		item := t.build(values)
+
+		// 准备/清理步骤只解析一层，步骤文件中的^Setup^/^Teardown^被忽略
+		item.Setup = createStepsFromFiles(t.setup, mac)
+		item.Teardown = createStepsFromFiles(t.teardown, mac)
+		queue = append(queue, item)
+	}
+	return
+}
+
+func createStepsFromFiles(names []string, mac string) (steps TestQueue) {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if t := parseTestItemFile(name, mac); t != nil {
+			steps = append(steps, t.build(nil))
+		}
+	}
+	return
+}
+
+// param 返回名称为name的参数，没有时返回nil
+func (t *testTemplate) param(name string) *TestParam {
+	for i := range t.params {
+		if t.params[i].Name == name {
+			return &t.params[i]
+		}
+	}
+	return nil
+}
+
+// expand 返回参数的所有组合，没有参数时返回一个空组合
+func (t *testTemplate) expand() []map[string]string {
+	combos := []map[string]string{{}}
+	for _, p := range t.params {
+		var next []map[string]string
+		for _, c := range combos {
+			for _, v := range p.Values {
+				n := map[string]string{p.Name: v}
+				for k, vv := range c {
+					n[k] = vv
+				}
+				next = append(next, n)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+func (t *testTemplate) build(values map[string]string) *TestItem {
+	replace := func(s string) string {
+		for k, v := range values {
+			s = strings.Replace(s, "${"+k+"}", v, -1)
+		}
+		return s
+	}
+
+	item := new(TestItem)
+	if err := json.Unmarshal([]byte(replace(t.request)), &item.Request); err != nil {
+		LogPrintln("[E]", "Convert JSON string error:", err)
+		item.Request = nil
+	}
+	item.Name = t.name
+	if len(values) > 0 {
+		// 生成的名称按参数声明顺序排列，如 SetWIFIChannel24G.elk[channel=1]
+		var args []string
+		for _, p := range t.params {
+			args = append(args, p.Name+"="+values[p.Name])
+		}
+		item.Name += "[" + strings.Join(args, ",") + "]"
+		item.Params = values
+	}
+	item.RecTimeOut = t.timeout
+	if item.RecTimeOut <= 0 {
+		item.RecTimeOut = 5
+	}
+	for _, k := range t.keywords {
+		item.ResponseKeyWord = append(item.ResponseKeyWord, replace(k))
+	}
+	item.Interface = t.title
+	item.MessageBox = replace(t.message)
+	item.Action = replace(t.action)
+	for _, v := range t.tags {
+		if v = strings.TrimSpace(v); v != "" {
+			item.Tags = append(item.Tags, v)
+		}
+	}
+	item.Retries = t.retries
+	item.RetryDelay = t.delay
+	if item.RetryDelay <= 0 {
+		item.RetryDelay = 1
+	}
+	item.XFail = t.xfail
+	item.Skip = t.skip
+	return item
+}
+
+func parseTestItemFile(name string, mac string) *testTemplate {
 	if _, err := os.Stat(name); os.IsNotExist(err) {
 		LogPrintln("[E]", "Error:", err)
 		return nil
@@ -56,55 +352,62 @@ func CreateTestItemFromFile(name string, mac string) *TestItem {
 	}
 	defer f.Close()
 
-	var request string
-	var timeout int
-	var keywords []string
-	var title string
-	var message string
+	t := &testTemplate{name: name}
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if strings.HasPrefix(line, "^RecTimeOut^") {
-			timeout, _ = strconv.Atoi(strings.TrimPrefix(line, "^RecTimeOut^"))
+			t.timeout, _ = strconv.Atoi(strings.TrimPrefix(line, "^RecTimeOut^"))
 		} else if strings.HasPrefix(line, "^ResponseKeyWord^") {
-			keywords = strings.Split(strings.TrimPrefix(line, "^ResponseKeyWord^"), "^")
-			for i, v := range keywords {
+			t.keywords = strings.Split(strings.TrimPrefix(line, "^ResponseKeyWord^"), "^")
+			for i, v := range t.keywords {
 				if v == STAMAC {
-					keywords[i] = mac
+					t.keywords[i] = mac
 				}
 			}
 		} else if strings.HasPrefix(line, "^Interface^") {
-			title = strings.TrimPrefix(line, "^Interface^")
+			t.title = strings.TrimPrefix(line, "^Interface^")
 		} else if strings.HasPrefix(line, "^MessageBox^") {
-			message = strings.TrimPrefix(line, "^MessageBox^")
+			t.message = strings.TrimPrefix(line, "^MessageBox^")
+		} else if strings.HasPrefix(line, "^Action^") {
+			t.action = strings.Replace(strings.TrimPrefix(line, "^Action^"), "${tmac}", mac, -1)
+		} else if strings.HasPrefix(line, "^Setup^") {
+			t.setup = append(t.setup, strings.Split(strings.TrimPrefix(line, "^Setup^"), "^")...)
+		} else if strings.HasPrefix(line, "^Teardown^") {
+			t.teardown = append(t.teardown, strings.Split(strings.TrimPrefix(line, "^Teardown^"), "^")...)
+		} else if strings.HasPrefix(line, "^Tags^") {
+			t.tags = append(t.tags, strings.Split(strings.TrimPrefix(line, "^Tags^"), "^")...)
+		} else if strings.HasPrefix(line, "^Retries^") {
+			t.retries, _ = strconv.Atoi(strings.TrimPrefix(line, "^Retries^"))
+		} else if strings.HasPrefix(line, "^RetryDelay^") {
+			t.delay, _ = strconv.Atoi(strings.TrimPrefix(line, "^RetryDelay^"))
+		} else if strings.HasPrefix(line, "^XFail^") {
+			t.xfail = strings.TrimPrefix(line, "^XFail^")
+		} else if strings.HasPrefix(line, "^Skip^") {
+			t.skip = strings.TrimPrefix(line, "^Skip^")
+		} else if strings.HasPrefix(line, "^Param^") {
+			p, err := parseTestParam(strings.TrimPrefix(line, "^Param^"))
+			if err == nil && t.param(p.Name) != nil {
+				err = fmt.Errorf(L("参数 %s 重复定义"), p.Name)
+			}
+			if err != nil {
+				LogPrintln("[E]", L("无效的测试参数:"), name, err)
+				return nil
+			}
+			t.params = append(t.params, p)
 		} else if strings.HasPrefix(line, "^") {
 			LogPrintln("[W]", "Unknown line:", line)
 		} else {
-			request += line
+			t.request += line
 		}
 	}
 
 	// 用指定的测试手机MAC地址替换请求头中的MAC地址
-	request = strings.Replace(request, STAMAC, mac, -1)
-
-	var item = new(TestItem)
-	if err = json.Unmarshal([]byte(request), &item.Request); err != nil {
-		LogPrintln("[E]", "Convert JSON string error:", err)
-		item.Request = nil
-	}
-	item.Name = name
-	item.RecTimeOut = timeout
-	if item.RecTimeOut <= 0 {
-		item.RecTimeOut = 5
-	}
-	item.ResponseKeyWord = keywords
-	item.Interface = title
-	item.MessageBox = message
-	item.Pass = false
-	return item
+	t.request = strings.Replace(t.request, STAMAC, mac, -1)
+	return t
 }
 
-func CreateTestQueueFromFile(file string, mac string) (queue TestQueue, err error) {
+func CreateTestSuiteFromFile(file string, mac string) (suite *TestSuite, err error) {
 	if _, err = os.Stat(file); os.IsNotExist(err) {
 		return
 	}
@@ -115,16 +418,63 @@ func CreateTestQueueFromFile(file string, mac string) (queue TestQueue, err erro
 	}
 	defer f.Close()
 
-	reader := csv.NewReader(f)
+	// 先挑出指令行，剩下的内容按CSV解析为测试用例列表
+	suite = &TestSuite{Name: file}
+	var setup, teardown []string
+	var body bytes.Buffer
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "^Setup^") {
+			setup = append(setup, strings.Split(strings.TrimPrefix(line, "^Setup^"), "^")...)
+		} else if strings.HasPrefix(line, "^Teardown^") {
+			teardown = append(teardown, strings.Split(strings.TrimPrefix(line, "^Teardown^"), "^")...)
+		} else if strings.HasPrefix(line, "^") {
+			LogPrintln("[W]", "Unknown line:", line)
+		} else {
+			body.WriteString(line)
+			body.WriteByte('\n')
+		}
+	}
+	suite.Setup = createStepsFromFiles(setup, mac)
+	suite.Teardown = createStepsFromFiles(teardown, mac)
+
+	reader := csv.NewReader(&body)
 	rec, _ := reader.ReadAll()
 	for _, r := range rec {
 		for _, c := range r {
-			item := CreateTestItemFromFile(c, mac)
-			if item != nil {
-				queue = append(queue, item)
-			}
+			suite.Items = append(suite.Items, CreateTestItemsFromFile(c, mac)...)
 		}
 	}
 
 	return
 }
+
+// Reported 返回需要出现在测试报告中的用例，即指定了接口名称的用例
+func (q TestQueue) Reported() (queue TestQueue) {
+	for _, v := range q {
+		if v.Interface != "" {
+			queue = append(queue, v)
+		}
+	}
+	return
+}
+
+// Summary 统计各种测试结论的数量，如“通过 30, 不通过 2, 跳过 1”
+func (q TestQueue) Summary() string {
+	var counts [VerdictSkip + 1]int
+	for _, v := range q {
+		counts[v.Verdict]++
+	}
+
+	var parts []string
+	for v := VerdictPass; v <= VerdictSkip; v++ {
+		if counts[v] > 0 {
+			parts = append(parts, fmt.Sprint(v, " ", counts[v]))
+		}
+	}
+	if counts[VerdictNone] > 0 {
+		parts = append(parts, fmt.Sprint(VerdictNone, " ", counts[VerdictNone]))
+	}
+	return strings.Join(parts, ", ")
+}
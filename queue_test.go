@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTestParam(t *testing.T) {
+	tests := []struct {
+		in     string
+		name   string
+		values []string
+		err    bool
+	}{
+		{in: "channel^1-3", name: "channel", values: []string{"1", "2", "3"}},
+		{in: "channel^7-7", name: "channel", values: []string{"7"}},
+		{in: "auth^wpapsk^wpa2psk", name: "auth", values: []string{"wpapsk", "wpa2psk"}},
+		{in: " auth ^ wpapsk ^wpa2psk ", name: "auth", values: []string{"wpapsk", "wpa2psk"}},
+		{in: "channel^1-2^36^ 149-149", name: "channel", values: []string{"1", "2", "36", "149"}},
+		{in: "band^2.4G-5G", name: "band", values: []string{"2.4G-5G"}},
+		{in: "channel", err: true},
+		{in: "channel^", err: true},
+		{in: "channel^ ", err: true},
+		{in: "channel^1^^2", err: true},
+		{in: "channel^13-1", err: true},
+		{in: "^1-3", err: true},
+		{in: " ^a", err: true},
+	}
+	for _, tt := range tests {
+		p, err := parseTestParam(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseTestParam(%q) = %+v, want error", tt.in, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTestParam(%q) error: %v", tt.in, err)
+			continue
+		}
+		if p.Name != tt.name || !reflect.DeepEqual(p.Values, tt.values) {
+			t.Errorf("parseTestParam(%q) = %q %q, want %q %q", tt.in, p.Name, p.Values, tt.name, tt.values)
+		}
+	}
+}
+
+func TestCreateTestItemsFromFileParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		file     string
+		names    []string
+		requests []string
+	}{
+		{
+			file:     "{\"type\":\"get_status\",\"sequence\":1,\"mac\":\"mac\"}\n^ResponseKeyWord^status\n",
+			names:    []string{"T.elk"},
+			requests: []string{"get_status"},
+		},
+		{
+			file:     "{\"type\":\"${t}\",\"sequence\":${ch},\"mac\":\"mac\"}\n^Param^ch^1-2\n^Param^t^cfg^get_status\n",
+			names:    []string{"T.elk[ch=1,t=cfg]", "T.elk[ch=1,t=get_status]", "T.elk[ch=2,t=cfg]", "T.elk[ch=2,t=get_status]"},
+			requests: []string{"cfg", "get_status", "cfg", "get_status"},
+		},
+		{
+			file: "{\"type\":\"cfg\",\"sequence\":1,\"mac\":\"mac\"}\n^Param^ch^13-1\n",
+		},
+		{
+			file: "{\"type\":\"cfg\",\"sequence\":1,\"mac\":\"mac\"}\n^Param^ch\n",
+		},
+		{
+			file: "{\"type\":\"cfg\",\"sequence\":1,\"mac\":\"mac\"}\n^Param^ch^1^6\n^Param^ch^11\n",
+		},
+	}
+	for i, tt := range tests {
+		name := filepath.Join(dir, "T.elk")
+		if err := ioutil.WriteFile(name, []byte(tt.file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		items := CreateTestItemsFromFile(name, STAMAC)
+
+		var names, requests []string
+		for _, v := range items {
+			names = append(names, filepath.Base(v.Name))
+			m, _ := v.Request.(map[string]interface{})
+			typ, _ := m["type"].(string)
+			requests = append(requests, typ)
+		}
+		if !reflect.DeepEqual(names, tt.names) || !reflect.DeepEqual(requests, tt.requests) {
+			t.Errorf("case %d: got %q %q, want %q %q", i, names, requests, tt.names, tt.requests)
+		}
+	}
+}
+
+func TestSuiteClone(t *testing.T) {
+	done := &TestItem{
+		Name:         "T.elk",
+		Interface:    "查询信息(表10)",
+		Retries:      2,
+		Verdict:      VerdictFail,
+		Attempts:     3,
+		ActionResult: &ActionResult{Command: "true"},
+		SkipReason:   "skip",
+		Latency:      time.Second,
+		Transcript:   []TranscriptEntry{{Dir: "O", Message: "{}"}},
+		Assertions:   []Assertion{{Keyword: "ack"}},
+		Duration:     time.Second,
+	}
+	suite := &TestSuite{Name: "q.txt", Items: TestQueue{done}}
+
+	c := suite.Clone()
+	want := TestItem{Name: "T.elk", Interface: "查询信息(表10)", Retries: 2}
+	if !reflect.DeepEqual(*c.Items[0], want) {
+		t.Errorf("Clone() item = %+v, want %+v", *c.Items[0], want)
+	}
+	if c.Items[0] == done || done.Verdict != VerdictFail || done.Attempts != 3 {
+		t.Error("Clone() changed the original item")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// reportTester 返回当前用户名作为测试人员
+func reportTester() string {
+	// Auto get tester's name
+	username := "nobody"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	return username
+}
+
+// reportData 是报告模板的数据，报告头的信息来自报告配置
+type reportData struct {
+	*ReportConfig
+	Tester      string
+	Device      DeviceInfo
+	Time        time.Time
+	ConnTimes   int
+	Interrupted string
+	Summary     string
+	Items       []reportRow
+	Coverage    *Coverage
+
+	// 签名公钥的指纹，不签名时为空
+	Fingerprint string
+}
+
+// reportRow 是报告中的一个测试，Index是报告中的序号
+type reportRow struct {
+	Index int
+	*TestItem
+}
+
+func newReportData(cli *Client, suite *TestSuite, interrupted string) *reportData {
+	d := &reportData{
+		ReportConfig: Report,
+		Tester:       Report.TesterName(),
+		Device:       cli.Info(),
+		Time:         time.Now(),
+		ConnTimes:    cli.ConnTimes(),
+		Interrupted:  interrupted,
+		Summary:      suite.Items.Reported().Summary(),
+		Coverage:     NewCoverage(suite.Items, SpecTables),
+		Fingerprint:  Signer.Fingerprint(),
+	}
+	for i, v := range suite.Items.Reported() {
+		d.Items = append(d.Items, reportRow{Index: i + 1, TestItem: v})
+	}
+	return d
+}
+
+// printReport 按报告模板在控制台输出测试报告并返回报告的文本，interrupted非空时说明报告只包含部分结果
+func printReport(cli *Client, suite *TestSuite, interrupted string) string {
+	var b strings.Builder
+	if err := Report.text.Execute(&b, newReportData(cli, suite, interrupted)); err != nil {
+		LogPrintln("[E]", L("报告模板错误:"), err)
+	}
+	lines := strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+
+	// 测试记录，满足应答关键词的消息用<<*标记
+	for i, v := range suite.Items.Reported() {
+		if !Report.showTranscript(v) {
+			continue
+		}
+		lines = append(lines, fmt.Sprint(L("测试记录: "), i+1, " ", v.Name, " ", v.Verdict))
+		if v.Verdict == VerdictFail || v.Verdict == VerdictXFail {
+			lines = append(lines, "   "+failureMessage(v))
+		}
+		for _, line := range strings.Split(strings.TrimRight(v.TranscriptText(), "\n"), "\n") {
+			if line != "" {
+				lines = append(lines, "   "+line)
+			}
+		}
+		lines = append(lines, "===============================================================================================")
+	}
+
+	for _, line := range lines {
+		LogPrintln("[T]", line)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// 内置的控制台报告模板
+var textReportTemplate = texttemplate.Must(texttemplate.New("report").Funcs(reportFuncs).Parse(
+	`===============================================================================================
+{{product .Device.Vendor .Device.Model}}{{L "e-Link自组网接口一致性测试报告"}}
+-----------------------------------------------------------------------------------------------
+{{L "测试依据："}} {{.Standard}}
+{{L "委托单位："}} {{.Client}}
+{{L "测试地点："}} {{.Location}}
+{{L "测试时间："}} {{.Time}}
+{{L "版 本 号："}} {{.Version}}
+{{L "测试人员："}} {{.Tester}}
+{{range .Fields}}{{.Name}}{{L "："}} {{.Value}}
+{{end}}{{L "连接次数："}} {{.ConnTimes}}
+{{if .Interrupted}}{{L "测试中断："}} {{.Interrupted}} {{L "（部分结果）"}}
+{{end}}===============================================================================================
+{{L "设备信息："}}
+{{range .Device.Rows}}    {{fw .Name 8}}{{L "："}} {{.Value}}
+{{end}}===============================================================================================
+{{fw (L "序号") 4}} | {{fw (L "测试接口名称") 40}} | {{fw (L "测试用例名称") 34}} | {{L "测试结果"}}
+-----------------------------------------------------------------------------------------------
+{{range .Items}}{{printf "%4v" .Index}} | {{fw .Interface 40}} | {{fw .Name 34}} | {{.Verdict}}
+{{end}}-----------------------------------------------------------------------------------------------
+{{L "结果统计："}} {{.Summary}}
+===============================================================================================
+`))
+
+// 进程退出码
+const (
+	ExitPass        = 0 // 全部测试通过
+	ExitFail        = 1 // 有测试不通过
+	ExitError       = 2 // 参数、配置或连接错误，或测试队列没能执行
+	ExitInterrupted = 3 // 被信号或总超时中断，只有部分结果
+)
+
+// ExitCode 根据测试结论计算进程退出码
+func ExitCode(queue TestQueue, interrupted string) int {
+	if interrupted != "" {
+		return ExitInterrupted
+	}
+	code := ExitPass
+	for _, v := range queue {
+		if v.Verdict == VerdictNone {
+			return ExitError
+		}
+		if !v.Verdict.Passed() {
+			code = ExitFail
+		}
+	}
+	return code
+}
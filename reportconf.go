@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 缺省的报告配置文件，不存在时使用内置的报告信息和模板
+const defaultReportConfig = "report.yml"
+
+// ReportField 是报告头中实验室自定义的项目，如委托单号、测试台编号
+type ReportField struct {
+	Name  string `yaml:"name" json:"name"`
+	Value string `yaml:"value" json:"value"`
+}
+
+// ReportConfig 是报告头的信息和报告模板，从报告配置文件和-report-set参数读取
+type ReportConfig struct {
+	Standard string        `yaml:"standard"`
+	Client   string        `yaml:"client"`
+	Location string        `yaml:"location"`
+	Version  string        `yaml:"version"`
+	Tester   string        `yaml:"tester"`
+	Fields   []ReportField `yaml:"fields"`
+
+	// 控制台报告之后输出哪些测试的消息记录：none不输出，failed只输出不通过的测试，all全部输出
+	Transcripts string `yaml:"transcripts"`
+
+	// 控制台报告和HTML报告的模板文件，相对于配置文件所在目录，为空时使用内置模板
+	TextTemplate string `yaml:"text_template"`
+	HTMLTemplate string `yaml:"html_template"`
+
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Report 是当前使用的报告配置，由main在启动时设置
+var Report = DefaultReportConfig()
+
+// DefaultReportConfig 返回内置的报告信息和模板，委托单位和测试地点因实验室而异，没有缺省值
+func DefaultReportConfig() *ReportConfig {
+	return &ReportConfig{
+		Standard: L("《中国电信家庭终端与智能家庭网关自动连接的接口技术要求》(Q/CT2621-2017)"),
+		Version:  "1.0",
+		text:     textReportTemplate,
+		html:     htmlReportTemplate,
+	}
+}
+
+// LoadReportConfig 读取报告配置文件，再用set中的“名称=值”覆盖。
+// 名称是standard、client、location、version、tester、transcripts时修改对应的信息，否则作为自定义项目
+func LoadReportConfig(name string, set []string) (*ReportConfig, error) {
+	r := DefaultReportConfig()
+	dir := "."
+	if name != "" {
+		b, err := ioutil.ReadFile(name)
+		if os.IsNotExist(err) && name == defaultReportConfig {
+			b, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(b, r); err != nil {
+			return nil, err
+		}
+		dir = filepath.Dir(name)
+	}
+
+	for _, v := range set {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			kv = append(kv, "")
+		}
+		r.set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	switch r.Transcripts {
+	case "", "none", "failed", "all":
+	default:
+		return nil, fmt.Errorf(L("无效的transcripts: %s，可以是none、failed或all"), r.Transcripts)
+	}
+
+	if r.TextTemplate != "" {
+		t, err := texttemplate.New(filepath.Base(r.TextTemplate)).Funcs(reportFuncs).ParseFiles(filepath.Join(dir, r.TextTemplate))
+		if err != nil {
+			return nil, err
+		}
+		r.text = t
+	}
+	if r.HTMLTemplate != "" {
+		t, err := htmltemplate.New(filepath.Base(r.HTMLTemplate)).Funcs(htmltemplate.FuncMap(reportFuncs)).ParseFiles(filepath.Join(dir, r.HTMLTemplate))
+		if err != nil {
+			return nil, err
+		}
+		r.html = t
+	}
+	return r, nil
+}
+
+// Unset 返回报告头中没有设置的委托单位和测试地点，返回的是报告配置中的名称
+func (r *ReportConfig) Unset() []string {
+	var names []string
+	if r.Client == "" {
+		names = append(names, "client")
+	}
+	if r.Location == "" {
+		names = append(names, "location")
+	}
+	return names
+}
+
+func (r *ReportConfig) set(name, value string) {
+	switch name {
+	case "standard":
+		r.Standard = value
+	case "client":
+		r.Client = value
+	case "location":
+		r.Location = value
+	case "version":
+		r.Version = value
+	case "tester":
+		r.Tester = value
+	case "transcripts":
+		r.Transcripts = value
+	default:
+		for i := range r.Fields {
+			if r.Fields[i].Name == name {
+				r.Fields[i].Value = value
+				return
+			}
+		}
+		r.Fields = append(r.Fields, ReportField{Name: name, Value: value})
+	}
+}
+
+// TesterName 返回配置的测试人员，没有配置时为当前用户名
+func (r *ReportConfig) TesterName() string {
+	if r.Tester != "" {
+		return r.Tester
+	}
+	return reportTester()
+}
+
+// showTranscript 判断是否在控制台报告之后输出测试的消息记录
+func (r *ReportConfig) showTranscript(q *TestItem) bool {
+	switch r.Transcripts {
+	case "all":
+		return true
+	case "failed":
+		return !q.Verdict.Passed() && q.Verdict != VerdictNone
+	}
+	return false
+}
+
+// 报告模板中可以使用的函数
+var reportFuncs = texttemplate.FuncMap{
+	"fw":      FW,
+	"fwclip":  FWClip,
+	"millis":  millis,
+	"L":       L,
+	"product": productTitle,
+}
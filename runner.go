@@ -0,0 +1,437 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RunOptions struct {
+	// 测试前保存设备配置，测试后自动恢复
+	Snapshot bool
+
+	// 无人值守时按ManualPolicy处理人工步骤，不等待标准输入
+	Unattended   bool
+	ManualPolicy string
+
+	// 人工提示的等待秒数，超时后按ManualPolicy处理，0表示一直等待
+	PromptTimeOut int
+
+	// ^Action^命令的最长执行秒数，超时后终止命令，测试不通过，0表示不限时
+	ActionTimeOut int
+}
+
+type Runner struct {
+	cli  *Client
+	opts RunOptions
+
+	// 收到停止请求后，当前测试不再等待应答、人工确认和动作，剩余测试保持未执行
+	stop       chan struct{}
+	stopOnce   sync.Once
+	stopReason string
+
+	// 正在执行的测试、等待应答的截止时间和各测试的结论，供HTTP控制接口和全屏界面并发读取
+	locker   sync.Mutex
+	current  *TestItem
+	deadline time.Time
+
+	// 保存每个测试的结果和记录，可以为nil
+	checkpoint *Checkpoint
+
+	// 测试前保存、尚未恢复的设备配置，强制退出时也要恢复，恢复完成后关闭restored
+	snapshot *Snapshot
+	restored chan struct{}
+}
+
+// 再次收到信号强制退出前，恢复设备配置最多等待的秒数
+const forcedRestoreTimeOut = 5
+
+func NewRunner(cli *Client, opts RunOptions) *Runner {
+	return &Runner{cli: cli, opts: opts, stop: make(chan struct{})}
+}
+
+// SetCheckpoint 设置保存测试结果的运行目录，已完成的测试不再执行
+func (r *Runner) SetCheckpoint(c *Checkpoint) {
+	r.checkpoint = c
+}
+
+// Stop 请求停止测试，正在等待的应答、人工确认和动作立即结束，
+// 可以多次调用，只有第一次的原因被记录
+func (r *Runner) Stop(reason string) {
+	r.stopOnce.Do(func() {
+		r.stopReason = reason
+		close(r.stop)
+	})
+}
+
+// Done 在收到停止请求后关闭
+func (r *Runner) Done() <-chan struct{} {
+	return r.stop
+}
+
+// Interrupted 返回停止原因，没有被停止时返回空字符串
+func (r *Runner) Interrupted() string {
+	select {
+	case <-r.stop:
+		return r.stopReason
+	default:
+		return ""
+	}
+}
+
+// Current 返回正在执行的测试，没有时返回nil
+func (r *Runner) Current() *TestItem {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	return r.current
+}
+
+// Verdict 返回测试当前的结论
+func (r *Runner) Verdict(q *TestItem) Verdict {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	return q.Verdict
+}
+
+// Deadline 返回当前测试等待应答的截止时间，没有在等待应答时返回零值
+func (r *Runner) Deadline() time.Time {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	return r.deadline
+}
+
+func (r *Runner) setDeadline(t time.Time) {
+	r.locker.Lock()
+	r.deadline = t
+	r.locker.Unlock()
+}
+
+func (r *Runner) setVerdict(q *TestItem, v Verdict) {
+	r.locker.Lock()
+	q.Verdict = v
+	r.locker.Unlock()
+}
+
+func (r *Runner) setCurrent(q *TestItem) {
+	r.locker.Lock()
+	r.current = q
+	r.locker.Unlock()
+
+	if q != nil {
+		SetLogField("test", q.Name)
+	} else {
+		SetLogField("test", "")
+	}
+}
+
+// RunSuite 执行整个测试队列。无论测试是否中途异常退出，
+// 队列的清理步骤和配置恢复都会被执行
+func (r *Runner) RunSuite(suite *TestSuite) {
+	QueryCapabilities(r.cli, r.Done())
+
+	if r.opts.Snapshot {
+		var snap *Snapshot
+		LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+		// 继续中断的测试时恢复第一次测试前的配置
+		if snap = r.checkpoint.Snapshot(); snap != nil {
+			LogPrintln("[T]", L("使用运行目录中保存的设备配置"))
+		} else {
+			LogPrintln("[T]", L("保存设备配置"))
+			snap = TakeSnapshot(r.cli)
+			r.checkpoint.SaveSnapshot(snap)
+		}
+		r.holdSnapshot(snap)
+	}
+
+	defer func() {
+		LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+		r.runSteps(L("清理步骤:"), suite.Teardown, nil)
+		r.restoreSnapshot()
+	}()
+
+	if !r.runSteps(L("准备步骤:"), suite.Setup, r.Done()) {
+		LogPrintln("[E]", L("测试队列准备失败，跳过全部测试"))
+		return
+	}
+
+	for i, q := range suite.Items {
+		if reason := r.Interrupted(); reason != "" {
+			LogPrintln("[W]", fmt.Sprintf(L("测试中断: %s，跳过剩余测试"), reason))
+			break
+		}
+		r.locker.Lock()
+		done := r.checkpoint.Restore(i, q)
+		r.locker.Unlock()
+		if done {
+			LogPrintln("[T]", L("已经完成:"), q.Name, q.Verdict)
+			continue
+		}
+		r.setCurrent(q)
+		r.checkpoint.Begin(i, q)
+		r.runTest(q)
+		r.checkpoint.Finish(i, q)
+		r.setCurrent(nil)
+	}
+}
+
+// holdSnapshot 记录测试前保存的设备配置，测试结束或强制退出时恢复
+func (r *Runner) holdSnapshot(snap *Snapshot) {
+	r.locker.Lock()
+	r.snapshot, r.restored = snap, make(chan struct{})
+	r.locker.Unlock()
+}
+
+// restoreSnapshot 恢复测试前保存的设备配置，已经恢复过或正在恢复时直接返回
+func (r *Runner) restoreSnapshot() {
+	r.locker.Lock()
+	snap, restored := r.snapshot, r.restored
+	r.snapshot = nil
+	r.locker.Unlock()
+	if snap == nil {
+		return
+	}
+
+	LogPrintln("[T]", L("恢复设备配置"))
+	snap.Restore(r.cli)
+	close(restored)
+}
+
+// ForceRestore 在强制退出前恢复设备配置，最多等待seconds秒。
+// 没有恢复完成时提示用-resume从运行目录中保存的配置恢复
+func (r *Runner) ForceRestore(seconds int) {
+	r.locker.Lock()
+	restored := r.restored
+	r.locker.Unlock()
+	if restored == nil {
+		return
+	}
+
+	// 测试结束时可能已经在恢复，这时只等待它完成
+	go r.restoreSnapshot()
+	select {
+	case <-restored:
+		return
+	case <-time.After(time.Duration(seconds) * time.Second):
+	}
+	if r.checkpoint.Snapshot() != nil {
+		LogPrintln("[W]", fmt.Sprintf(L("设备配置没有恢复完成，可以用 -resume %s 继续测试，结束后恢复保存的配置"), r.checkpoint.Dir))
+	} else {
+		LogPrintln("[W]", L("设备配置没有恢复完成，设备可能保留了测试中修改的配置"))
+	}
+}
+
+// runSteps 依次执行准备/清理步骤，全部成功时返回true。
+// cancel关闭时不再等待应答，清理步骤传nil，停止测试时也要执行完
+func (r *Runner) runSteps(title string, steps TestQueue, cancel <-chan struct{}) bool {
+	ok := true
+	for _, s := range steps {
+		LogPrintln("[T]", title, s.Name)
+		r.cli.SendRequest(s.Request)
+		if !r.cli.WaitAndCheckResponse(s.RecTimeOut, s.ResponseKeyWord, cancel) {
+			LogPrintln("[W]", title, s.Name, L("失败"))
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (r *Runner) runTest(q *TestItem) {
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+	LogPrintln("[T]", L("测试名称:"), q.Name)
+	if q.Interface != "" {
+		LogPrintln("[T]", L("接口名称:"), q.Interface)
+	}
+	LogPrintln("[T]", fmt.Sprintf(L("超时时间: %d 秒"), q.RecTimeOut))
+	LogPrintln("[T]", L("词语匹配:"), q.ResponseKeyWord)
+
+	q.SkipReason = q.Skip
+	if q.SkipReason == "" && r.opts.Unattended && r.opts.ManualPolicy == ManualSkip && q.MessageBox != "" && q.Action == "" {
+		q.SkipReason = L("无人值守，跳过人工步骤")
+	}
+	if q.SkipReason != "" {
+		r.setVerdict(q, VerdictSkip)
+		LogPrintln("[T]", L("跳过原因:"), q.SkipReason)
+		LogPrintln("[T]", L("测试结果:"), q.Verdict)
+		LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+		return
+	}
+
+	passed := false
+	delay := q.RetryDelay
+	q.Attempts = 0
+	for attempt := 1; attempt <= q.Retries+1; attempt++ {
+		if attempt > 1 {
+			LogPrintln("[T]", fmt.Sprintf(L("等待重试: %d 秒"), delay))
+			select {
+			case <-r.Done():
+			case <-time.After(time.Duration(delay) * time.Second):
+			}
+			if r.Interrupted() != "" {
+				// 重试还没有执行，已有的结论不是最终结果
+				r.discardResult(q)
+				return
+			}
+			delay *= 2
+			LogPrintln("[T]", L("重试次数:"), attempt-1, "/", q.Retries)
+		}
+		q.Attempts = attempt
+
+		// 准备步骤失败时不发送请求，直接判为不通过，但清理步骤照常执行
+		passed = false
+		q.Transcript, q.Assertions = nil, nil
+		skipped := false
+		if r.runSteps(L("准备步骤:"), q.Setup, r.Done()) {
+			passed, skipped = r.runRequest(q)
+		}
+		r.runSteps(L("清理步骤:"), q.Teardown, nil)
+		if !passed && r.Interrupted() != "" {
+			// 等待被停止打断，结论不可信
+			r.discardResult(q)
+			return
+		}
+		if skipped {
+			q.SkipReason = L("人工步骤未确认")
+			r.setVerdict(q, VerdictSkip)
+			LogPrintln("[T]", L("跳过原因:"), q.SkipReason)
+			LogPrintln("[T]", L("测试结果:"), q.Verdict)
+			LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+			return
+		}
+		if passed {
+			break
+		}
+	}
+
+	switch {
+	case q.XFail != "" && passed:
+		r.setVerdict(q, VerdictXPass)
+	case q.XFail != "":
+		r.setVerdict(q, VerdictXFail)
+	case passed && q.Attempts > 1:
+		r.setVerdict(q, VerdictPassAfterRetry)
+	case passed:
+		r.setVerdict(q, VerdictPass)
+	default:
+		r.setVerdict(q, VerdictFail)
+	}
+
+	// Show result
+	if q.XFail != "" {
+		LogPrintln("[T]", L("预期失败:"), q.XFail)
+	}
+	LogPrintln("[T]", L("测试结果:"), q.Verdict)
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+}
+
+// discardResult 在测试被停止时清除结论，不保存结果，继续测试时重新执行
+func (r *Runner) discardResult(q *TestItem) {
+	r.setVerdict(q, VerdictNone)
+	LogPrintln("[W]", L("测试被停止，结果不保存"))
+	LogPrintln("[T]", L("测试结果:"), q.Verdict)
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+}
+
+// runRequest 执行人工步骤后发送请求并检查应答，人工步骤被跳过时第二个返回值为true
+func (r *Runner) runRequest(q *TestItem) (bool, bool) {
+	// 配置了动作时自动执行，否则提示人工操作
+	if q.Action != "" {
+		if q.MessageBox != "" {
+			LogPrintln("[T]", "---", q.MessageBox, "---")
+		}
+		if !runAction(r.cli, q, r.opts.ActionTimeOut, r.Done()) {
+			return false, false
+		}
+	} else if q.MessageBox != "" {
+		LogPrintln("[T]", "---", q.MessageBox, "---")
+		result := PromptConfirmed
+		if !r.opts.Unattended {
+			LogPrintln("[T]", "---", L("按回车键继续"), ">>>>>>>>")
+			LogEnable(false)
+			result = WaitEnter(q.MessageBox, r.opts.PromptTimeOut, r.Done())
+			LogEnable(true)
+		}
+
+		switch result {
+		case PromptCanceled:
+			return false, false
+		case PromptTimeOut:
+			LogPrintln("[T]", "---", L("等待超时"), "---")
+		case PromptClosed:
+			LogPrintln("[W]", L("标准输入已关闭，启用无人值守模式"))
+			r.opts.Unattended = true
+		}
+		if result != PromptConfirmed || r.opts.Unattended {
+			if r.opts.ManualPolicy == ManualSkip {
+				return false, true
+			}
+			LogPrintln("[T]", "---", L("自动确认"), "---")
+		}
+	}
+
+	// Send request
+	testBegin := time.Now()
+	LogPrintln("[T]", L("打印开始:"), "vvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvv")
+	// 请求写入连接时记录发送时间，在这之后收到的应答不会被清空
+	sent := make(chan time.Time, 1)
+	r.cli.drainResponse()
+	r.cli.SendWritten(q.Request, func(t time.Time) { sent <- t })
+
+	// Wait response and check keywords
+	r.setDeadline(testBegin.Add(time.Duration(q.RecTimeOut) * time.Second))
+	pass := r.waitResponse(q, testBegin, sent)
+	r.setDeadline(time.Time{})
+	q.Duration = time.Since(testBegin)
+
+	LogPrintln("[T]", L("打印结束:"), "^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^")
+	LogPrintln("[T]", fmt.Sprintf(L("花费时间: %v 秒"), time.Now().Sub(testBegin).Seconds()))
+	return pass, false
+}
+
+// waitResponse 等待包含全部关键词的应答，同时记录收到的消息和每个关键词是否出现过，
+// 应答时间从请求写入连接的时间sent开始计算
+func (r *Runner) waitResponse(q *TestItem, begin time.Time, sent <-chan time.Time) bool {
+	// 应答总是在请求写入连接之后处理，收到消息时发送时间已经在sent中
+	var sentAt time.Time
+	recordSent := func() {
+		if sentAt.IsZero() {
+			select {
+			case sentAt = <-sent:
+				q.recordSent(sentAt)
+			default:
+			}
+		}
+	}
+
+	matched := map[string]bool{}
+	q.Transcript, q.Latency = nil, 0
+	_, pass := r.cli.WaitResponse(q.RecTimeOut, r.Done(), func(msg string) bool {
+		recordSent()
+		if sentAt.IsZero() {
+			// 请求写入连接前收到的消息不是它的应答
+			return false
+		}
+		ok := true
+		for _, v := range q.ResponseKeyWord {
+			if strings.Contains(msg, v) {
+				matched[v] = true
+			} else {
+				ok = false
+			}
+		}
+		q.recordReceived(msg, ok)
+		return ok
+	})
+	recordSent()
+	if sentAt.IsZero() {
+		// 请求没有写入连接（如设备断线），记录放入发送队列的时间
+		q.recordSent(begin)
+	} else if pass {
+		q.Latency = q.Transcript[len(q.Transcript)-1].Time.Sub(sentAt)
+	}
+
+	for _, v := range q.ResponseKeyWord {
+		q.Assertions = append(q.Assertions, Assertion{Keyword: v, Matched: matched[v]})
+	}
+	return pass
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 运行目录中的签名清单和签名文件，控制台报告也保存在运行目录中，
+// 运行目录以外的报告和日志签名前复制到signedDir中
+const (
+	manifestName   = "manifest.json"
+	manifestSig    = "manifest.sig"
+	reportTextName = "report.txt"
+	signedDir      = "signed"
+)
+
+// ManifestFile 是清单中的一个文件，Path相对于运行目录
+type ManifestFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Manifest 记录运行目录中的报告、测试记录和日志的SHA-256，manifest.sig是它的Ed25519签名
+type Manifest struct {
+	Created     time.Time      `json:"created"`
+	Device      DeviceInfo     `json:"device"`
+	PublicKey   string         `json:"public_key"`
+	Fingerprint string         `json:"fingerprint"`
+	Files       []ManifestFile `json:"files"`
+}
+
+// ReportSigner 用实验室的Ed25519私钥签名测试报告
+type ReportSigner struct {
+	key ed25519.PrivateKey
+}
+
+// Signer 是-sign-key指定的签名私钥，为nil时不签名
+var Signer *ReportSigner
+
+// LoadSigner 读取PEM格式的Ed25519私钥，如 openssl genpkey -algorithm ed25519 生成的PKCS#8私钥
+func LoadSigner(name string) (*ReportSigner, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New(L("不是PEM格式的私钥"))
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf(L("不是Ed25519私钥: %T"), key)
+	}
+	return &ReportSigner{key: priv}, nil
+}
+
+// LoadPublicKey 读取PEM格式的Ed25519公钥，如 openssl pkey -pubout 导出的公钥
+func LoadPublicKey(name string) (ed25519.PublicKey, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New(L("不是PEM格式的公钥"))
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf(L("不是Ed25519公钥: %T"), key)
+	}
+	return pub, nil
+}
+
+// KeyFingerprint 返回公钥的指纹，格式与ssh-keygen -l相同
+func KeyFingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// Fingerprint 返回签名公钥的指纹，没有签名私钥时为空
+func (s *ReportSigner) Fingerprint() string {
+	if s == nil {
+		return ""
+	}
+	return KeyFingerprint(s.key.Public().(ed25519.PublicKey))
+}
+
+// hashFile 计算文件的SHA-256
+func hashFile(name string) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// copyIntoRunDir 把运行目录以外的文件复制到运行目录的signedDir中，运行目录中的文件不复制。
+// 清单只包含运行目录中的文件，整个运行目录可以移动或打包交给委托单位
+func copyIntoRunDir(dir string, files []string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	copied := map[string]string{}
+	for _, v := range files {
+		if v == "" {
+			continue
+		}
+		abs, err := filepath.Abs(v)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(absDir, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		name := filepath.Base(abs)
+		if other, ok := copied[name]; ok && other != abs {
+			return fmt.Errorf(L("%s 和 %s 的文件名相同，不能都复制到运行目录"), other, v)
+		}
+		copied[name] = abs
+		b, err := ioutil.ReadFile(abs)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(dir, signedDir), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, signedDir, name), b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runDirFiles 返回运行目录中除清单和签名以外的全部文件，是相对于运行目录的路径
+func runDirFiles(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != manifestName && rel != manifestSig {
+			paths = append(paths, rel)
+		}
+		return err
+	})
+	sort.Strings(paths)
+	return paths, err
+}
+
+// SignRunDir 把files中的报告和日志复制到运行目录，计算运行目录中全部文件的SHA-256，写入清单并签名
+func (s *ReportSigner) SignRunDir(dir string, device DeviceInfo, files []string) error {
+	if err := copyIntoRunDir(dir, files); err != nil {
+		return err
+	}
+
+	m := &Manifest{
+		Created:     time.Now(),
+		Device:      device,
+		PublicKey:   base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey)),
+		Fingerprint: s.Fingerprint(),
+		Files:       []ManifestFile{},
+	}
+
+	paths, err := runDirFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, v := range paths {
+		sum, size, err := hashFile(filepath.Join(dir, v))
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, ManifestFile{Path: filepath.ToSlash(v), SHA256: sum, Size: size})
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, manifestName), b, 0644); err != nil {
+		return err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, b))
+	return ioutil.WriteFile(filepath.Join(dir, manifestSig), []byte(sig+"\n"), 0644)
+}
+
+// VerifyRunDir 校验运行目录中清单的签名和每个文件的SHA-256，运行目录中不能有清单以外的文件，返回进程退出码。
+// pubkey为空时使用清单中的公钥，只能说明清单没有损坏，不能说明是谁签名的，
+// 这时即使全部正确也不算校验通过
+func VerifyRunDir(dir, pubkey string) int {
+	b, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		LogPrintln("[E]", L("读取签名清单错误:"), err)
+		return ExitError
+	}
+	sig, err := ioutil.ReadFile(filepath.Join(dir, manifestSig))
+	if err != nil {
+		LogPrintln("[E]", L("读取签名错误:"), err)
+		return ExitError
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		LogPrintln("[E]", L("无效的签名清单:"), err)
+		return ExitError
+	}
+
+	var pub ed25519.PublicKey
+	if pubkey != "" {
+		if pub, err = LoadPublicKey(pubkey); err != nil {
+			LogPrintln("[E]", L("读取公钥错误:"), pubkey, err)
+			return ExitError
+		}
+	} else {
+		key, err := base64.StdEncoding.DecodeString(m.PublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			LogPrintln("[E]", L("清单中的公钥无效"))
+			return ExitFail
+		}
+		pub = ed25519.PublicKey(key)
+		LogPrintln("[W]", fmt.Sprintf(L("没有指定-pubkey，使用清单中的公钥，请确认指纹 %s 是实验室的公钥"), KeyFingerprint(pub)))
+	}
+
+	fmt.Println(L("运行目录:"), dir)
+	fmt.Println(L("签名时间:"), m.Created.Local().Format("2006-01-02 15:04:05"))
+	fmt.Println(L("设备:"), m.Device.Vendor, m.Device.Model, m.Device.SWVersion, m.Device.MAC)
+	fmt.Println(L("公钥指纹:"), KeyFingerprint(pub))
+
+	ok := true
+	s, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+	if err != nil || !ed25519.Verify(pub, b, s) {
+		fmt.Println(L("签名: 无效"))
+		ok = false
+	} else {
+		fmt.Println(L("签名: 有效"))
+	}
+
+	listed := map[string]bool{}
+	for _, v := range m.Files {
+		listed[v.Path] = true
+		sum, n, err := hashFile(filepath.Join(dir, filepath.FromSlash(v.Path)))
+		switch {
+		case err != nil:
+			fmt.Println(L("错误"), v.Path, err)
+			ok = false
+		case sum != v.SHA256 || n != v.Size:
+			fmt.Println(L("修改"), v.Path)
+			ok = false
+		default:
+			fmt.Println(L("正确"), v.Path)
+		}
+	}
+
+	// 签名后放进运行目录的文件不在清单中，也算被修改
+	paths, err := runDirFiles(dir)
+	if err != nil {
+		fmt.Println(L("错误"), dir, err)
+		ok = false
+	}
+	for _, v := range paths {
+		if !listed[filepath.ToSlash(v)] {
+			fmt.Println(L("多余"), filepath.ToSlash(v))
+			ok = false
+		}
+	}
+
+	if !ok {
+		LogPrintln("[E]", L("校验失败，报告或记录被修改过"))
+		return ExitFail
+	}
+	if pubkey == "" {
+		LogPrintln("[W]", fmt.Sprintf(L("只校验了完整性：%d 个文件没有被修改，但没有用-pubkey指定可信的公钥，签名者未验证"), len(m.Files)))
+		return ExitError
+	}
+	fmt.Println(fmt.Sprintf(L("校验通过，共 %d 个文件"), len(m.Files)))
+	return ExitPass
+}
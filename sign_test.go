@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePublicKey 把公钥保存为PEM文件，与 openssl pkey -pubout 的格式相同
+func writePublicKey(t *testing.T, name string, pub ed25519.PublicKey) {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignAndVerifyRunDir(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &ReportSigner{key: priv}
+
+	tests := []struct {
+		name   string
+		modify func(run string) error
+		other  bool
+		nokey  bool
+		code   int
+	}{
+		{name: "intact", code: ExitPass},
+		{name: "no trusted key", nokey: true, code: ExitError},
+		{name: "other key", other: true, code: ExitFail},
+		{name: "tampered result", code: ExitFail, modify: func(run string) error {
+			return ioutil.WriteFile(filepath.Join(run, "results.jsonl"), []byte("{\"verdict\":1}\n"), 0644)
+		}},
+		{name: "tampered copied report", code: ExitFail, modify: func(run string) error {
+			f, err := os.OpenFile(filepath.Join(run, signedDir, "report.html"), os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.WriteString("<p>PASS</p>")
+			return err
+		}},
+		{name: "removed transcript", code: ExitFail, modify: func(run string) error {
+			return os.Remove(filepath.Join(run, "001-T.elk.log"))
+		}},
+		{name: "planted report", code: ExitFail, modify: func(run string) error {
+			return ioutil.WriteFile(filepath.Join(run, signedDir, "report2.html"), []byte("<p>PASS</p>"), 0644)
+		}},
+		{name: "planted file in new directory", code: ExitFail, modify: func(run string) error {
+			if err := os.MkdirAll(filepath.Join(run, "extra"), 0755); err != nil {
+				return err
+			}
+			return ioutil.WriteFile(filepath.Join(run, "extra", "results.jsonl"), []byte("{\"verdict\":1}\n"), 0644)
+		}},
+		{name: "tampered manifest", code: ExitFail, modify: func(run string) error {
+			b, err := ioutil.ReadFile(filepath.Join(run, manifestName))
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(filepath.Join(run, manifestName), append(b, ' '), 0644)
+		}},
+	}
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "elinks")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		run := filepath.Join(dir, "run")
+		files := map[string]string{
+			filepath.Join(run, "results.jsonl"): "{\"verdict\":3}\n",
+			filepath.Join(run, "001-T.elk.log"): "transcript\n",
+			filepath.Join(run, reportTextName):  "report\n",
+			filepath.Join(dir, "report.html"):   "<p>FAIL</p>",
+			filepath.Join(dir, "elinks.log"):    "log\n",
+		}
+		if err := os.MkdirAll(run, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range files {
+			if err := ioutil.WriteFile(k, []byte(v), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		extra := []string{"", filepath.Join(dir, "report.html"), filepath.Join(dir, "elinks.log"), filepath.Join(run, reportTextName)}
+		if err := signer.SignRunDir(run, DeviceInfo{MAC: "940E6B445754"}, extra); err != nil {
+			t.Fatalf("%s: SignRunDir: %v", tt.name, err)
+		}
+		for _, v := range []string{"report.html", "elinks.log"} {
+			if _, err := os.Stat(filepath.Join(run, signedDir, v)); err != nil {
+				t.Errorf("%s: %s not copied into the run directory: %v", tt.name, v, err)
+			}
+		}
+
+		// 签名后运行目录以外的文件被修改不影响校验
+		if err := ioutil.WriteFile(filepath.Join(dir, "report.html"), []byte("<p>PASS</p>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if tt.modify != nil {
+			if err := tt.modify(run); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		key := filepath.Join(dir, "lab.pub")
+		if tt.other {
+			writePublicKey(t, key, otherPub)
+		} else {
+			writePublicKey(t, key, pub)
+		}
+		if tt.nokey {
+			key = ""
+		}
+		if code := VerifyRunDir(run, key); code != tt.code {
+			t.Errorf("%s: VerifyRunDir = %d, want %d", tt.name, code, tt.code)
+		}
+	}
+}
+
+func TestSignRunDirSameBaseName(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "elinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	run := filepath.Join(dir, "run")
+	for _, v := range []string{run, filepath.Join(dir, "a"), filepath.Join(dir, "b")} {
+		if err := os.MkdirAll(v, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := filepath.Join(dir, "a", "report.json"), filepath.Join(dir, "b", "report.json")
+	for _, v := range []string{a, b} {
+		if err := ioutil.WriteFile(v, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := (&ReportSigner{key: priv}).SignRunDir(run, DeviceInfo{}, []string{a, b}); err == nil {
+		t.Error("SignRunDir with two reports named report.json succeeded, want error")
+	}
+}
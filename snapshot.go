@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// 测试前通过get_status保存、测试后通过cfg恢复的设备配置项：
+// 射频/AP(wifi)、WiFi开关、LED开关、WPS开关和WiFi定时
+var SnapshotNames = []string{"wifi", "wifiswitch", "ledswitch", "wpsswitch", "wifitimer"}
+
+const (
+	snapshotSequence = 20001
+	snapshotTimeOut  = 10
+)
+
+type Snapshot struct {
+	Status map[string]interface{}
+}
+
+// {"type":"status","sequence":20001,"mac":"940E6B445754","status":{"ledswitch":{"status":"ON"}}}
+func parseStatusReply(msg string, name string) (interface{}, bool) {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(msg), &m); err != nil {
+		return nil, false
+	}
+	if t, _ := m["type"].(string); t != "status" {
+		return nil, false
+	}
+	status, ok := m["status"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	v, ok := status[name]
+	return v, ok
+}
+
+// {"type":"ack","sequence":20001,"mac":"940E6B445754"}
+func isAckOf(msg string, sequence int) bool {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(msg), &m); err != nil {
+		return false
+	}
+	t, _ := m["type"].(string)
+	seq, _ := m["sequence"].(float64)
+	return t == "ack" && int(seq) == sequence
+}
+
+// TakeSnapshot 逐项查询设备当前配置，查询失败的项不会被恢复
+func TakeSnapshot(cli *Client) *Snapshot {
+	s := &Snapshot{Status: map[string]interface{}{}}
+	for i, name := range SnapshotNames {
+		sequence := snapshotSequence + i
+		cli.SendRequest(map[string]interface{}{
+			"type":     "get_status",
+			"sequence": sequence,
+			"mac":      cli.MAC(),
+			"get":      []interface{}{map[string]interface{}{"name": name}},
+		})
+
+		var value interface{}
+		_, ok := cli.WaitResponse(snapshotTimeOut, nil, func(msg string) bool {
+			var found bool
+			value, found = parseStatusReply(msg, name)
+			return found
+		})
+		if ok {
+			s.Status[name] = value
+			LogPrintln("[T]", L("保存配置:"), name)
+		} else {
+			LogPrintln("[W]", L("保存配置失败:"), name)
+		}
+	}
+	return s
+}
+
+// Restore 把保存的配置逐项通过cfg下发给设备
+func (s *Snapshot) Restore(cli *Client) {
+	for i, name := range SnapshotNames {
+		value, ok := s.Status[name]
+		if !ok {
+			continue
+		}
+
+		sequence := snapshotSequence + len(SnapshotNames) + i
+		cli.SendRequest(map[string]interface{}{
+			"type":     "cfg",
+			"sequence": sequence,
+			"mac":      cli.MAC(),
+			"set":      map[string]interface{}{name: value},
+		})
+		if _, ok := cli.WaitResponse(snapshotTimeOut, nil, func(msg string) bool {
+			return isAckOf(msg, sequence)
+		}); ok {
+			LogPrintln("[T]", L("恢复配置:"), name)
+		} else {
+			LogPrintln("[W]", L("恢复配置失败:"), name)
+		}
+	}
+}
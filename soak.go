@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SoakOptions 是稳定性测试的轮数和时长，都为0时一直执行到被中断
+type SoakOptions struct {
+	Iterations int
+	Duration   time.Duration
+}
+
+// SoakIteration 是稳定性测试一轮的结果
+type SoakIteration struct {
+	Index     int
+	Start     time.Time
+	End       time.Time
+	Suite     *TestSuite
+	ConnTimes int // 本轮结束时的连接次数
+
+	// 本轮中同一连接上相邻两次心跳的间隔
+	Keepalives []time.Duration
+}
+
+// SoakReconnect 记录一次断线，Up为零值表示没有恢复
+type SoakReconnect struct {
+	Down time.Time
+	Up   time.Time
+}
+
+// Soak 重复执行测试队列，统计每轮结果、连接次数、断线重连、心跳间隔和应答时间的变化
+type Soak struct {
+	cli    *Client
+	runner *Runner
+	opts   SoakOptions
+
+	// 心跳由消息接收协程记录
+	locker        sync.Mutex
+	lastKeepalive time.Time
+	lastConnTimes int
+	intervals     []time.Duration
+
+	start      time.Time
+	startConn  int
+	Iterations []*SoakIteration
+}
+
+// NewSoak 创建稳定性测试，需要在设备连接前调用以便记录心跳
+func NewSoak(cli *Client, runner *Runner, opts SoakOptions) *Soak {
+	s := &Soak{cli: cli, runner: runner, opts: opts}
+	cli.Observe(s.observe)
+	return s
+}
+
+// observe 记录设备的心跳，在接收协程中调用，此时持有cli.locker
+func (s *Soak) observe(dir string, msg string) {
+	if dir != "I" {
+		return
+	}
+	var m struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal([]byte(msg), &m) != nil || m.Type != "keepalive" {
+		return
+	}
+
+	now := time.Now()
+	s.locker.Lock()
+	// 重连后的第一次心跳不计算间隔
+	if !s.lastKeepalive.IsZero() && s.lastConnTimes == s.cli.connTimes {
+		s.intervals = append(s.intervals, now.Sub(s.lastKeepalive))
+	}
+	s.lastKeepalive = now
+	s.lastConnTimes = s.cli.connTimes
+	s.locker.Unlock()
+}
+
+// takeIntervals 返回并清空已记录的心跳间隔
+func (s *Soak) takeIntervals() []time.Duration {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	intervals := s.intervals
+	s.intervals = nil
+	return intervals
+}
+
+// Run 重复执行测试队列，直到达到轮数或时长，或者被中断。
+// 时长在每轮开始前检查，已经开始的一轮会执行完
+func (s *Soak) Run(suite *TestSuite, connTimeOut int) {
+	s.start = time.Now()
+	s.startConn = s.cli.ConnTimes()
+	s.takeIntervals()
+
+	for i := 1; ; i++ {
+		if s.opts.Iterations > 0 && i > s.opts.Iterations {
+			break
+		}
+		if s.opts.Duration > 0 && time.Since(s.start) >= s.opts.Duration {
+			break
+		}
+		if reason := s.runner.Interrupted(); reason != "" {
+			LogPrintln("[W]", L("稳定性测试中断:"), reason)
+			break
+		}
+
+		// 上一轮可能重启了设备，等待设备重新注册
+		if !s.cli.WaitReadyTimeout(connTimeOut, s.runner.Done()) {
+			if s.runner.Interrupted() == "" {
+				s.runner.Stop(fmt.Sprintf(L("等待设备重新连接超过 %d 秒"), connTimeOut))
+			}
+			LogPrintln("[E]", L("稳定性测试中断:"), s.runner.Interrupted())
+			break
+		}
+
+		it := &SoakIteration{Index: i, Start: time.Now(), Suite: suite.Clone()}
+		LogPrintln("[T]", "===============================================================================================")
+		LogPrintln("[T]", fmt.Sprintf(L("稳定性测试第 %d 轮"), i))
+		s.runner.RunSuite(it.Suite)
+		it.End = time.Now()
+		it.ConnTimes = s.cli.ConnTimes()
+		it.Keepalives = s.takeIntervals()
+		s.Iterations = append(s.Iterations, it)
+		LogPrintln("[T]", fmt.Sprintf(L("第 %d 轮结果: %s，用时 %v"), i, it.Suite.Items.Reported().Summary(), it.End.Sub(it.Start).Truncate(time.Second)))
+	}
+}
+
+// Reconnects 返回稳定性测试期间的断线记录
+func (s *Soak) Reconnects() []SoakReconnect {
+	var reconnects []SoakReconnect
+	for _, e := range s.cli.ConnEvents() {
+		if e.Time.Before(s.start) {
+			continue
+		}
+		n := len(reconnects)
+		switch e.State {
+		case StateDisconnected:
+			if n == 0 || !reconnects[n-1].Up.IsZero() {
+				reconnects = append(reconnects, SoakReconnect{Down: e.Time})
+			}
+		case StateELKConnected:
+			if n > 0 && reconnects[n-1].Up.IsZero() {
+				reconnects[n-1].Up = e.Time
+			}
+		}
+	}
+	return reconnects
+}
+
+// averageLatency 返回一轮中收到匹配应答的测试的平均应答时间
+func (it *SoakIteration) averageLatency() time.Duration {
+	var total time.Duration
+	count := 0
+	for _, v := range it.Suite.Items.Reported() {
+		if v.Latency > 0 {
+			total += v.Latency
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
+}
+
+// keepaliveStats 返回心跳间隔的平均值和最大值
+func (it *SoakIteration) keepaliveStats() (time.Duration, time.Duration) {
+	var total, max time.Duration
+	for _, v := range it.Keepalives {
+		total += v
+		if v > max {
+			max = v
+		}
+	}
+	if len(it.Keepalives) == 0 {
+		return 0, 0
+	}
+	return total / time.Duration(len(it.Keepalives)), max
+}
+
+// millis 以毫秒显示应答时间，局域网内的应答通常不到1毫秒
+func millis(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// PrintReport 在控制台输出稳定性测试报告
+func (s *Soak) PrintReport(interrupted string) {
+	LogPrintln("[T]", "===============================================================================================")
+	info := s.cli.Info()
+	LogPrintln("[T]", productTitle(info.Vendor, info.Model)+L("e-Link稳定性测试报告"))
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+	LogPrintln("[T]", L("开始时间："), s.start.Format("2006-01-02 15:04:05"))
+	LogPrintln("[T]", L("测试时长："), time.Since(s.start).Truncate(time.Second))
+	LogPrintln("[T]", L("执行轮数："), len(s.Iterations))
+	LogPrintln("[T]", L("连接次数："), s.startConn, "->", s.cli.ConnTimes())
+	if interrupted != "" {
+		LogPrintln("[T]", fmt.Sprintf(L("测试中断：%s（部分结果）"), interrupted))
+	}
+	LogPrintln("[T]", "===============================================================================================")
+	LogPrintln("[T]", FW(L("轮次"), 4), "|", FW(L("开始时间"), 8), "|", FW(L("用时"), 8), "|", FW(L("结果统计"), 24), "|", FW(L("连接次数"), 8), "|", FW(L("平均应答"), 10), "|", L("心跳间隔(平均/最大)"))
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+	for _, it := range s.Iterations {
+		keepalive := "-"
+		if avg, max := it.keepaliveStats(); max > 0 {
+			keepalive = fmt.Sprint(avg.Round(time.Millisecond), " / ", max.Round(time.Millisecond))
+		}
+		LogPrintln("[T]", fmt.Sprintf("%4v", it.Index), "|", it.Start.Format("15:04:05"), "|",
+			FW(it.End.Sub(it.Start).Truncate(time.Second).String(), 8), "|",
+			FW(it.Suite.Items.Reported().Summary(), 24), "|", fmt.Sprintf("%8v", it.ConnTimes), "|",
+			FW(millis(it.averageLatency()), 10), "|", keepalive)
+	}
+
+	// 断线重连
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+	reconnects := s.Reconnects()
+	LogPrintln("[T]", L("断线次数："), len(reconnects))
+	for _, v := range reconnects {
+		if v.Up.IsZero() {
+			LogPrintln("[T]", "  ", fmt.Sprintf(L("%s 断开，没有恢复"), v.Down.Format("15:04:05")))
+		} else {
+			LogPrintln("[T]", "  ", fmt.Sprintf(L("%s 断开，%s 恢复，间隔 %v"), v.Down.Format("15:04:05"), v.Up.Format("15:04:05"), v.Up.Sub(v.Down).Truncate(time.Millisecond)))
+		}
+	}
+
+	// 应答时间的变化，比较第一轮和最后一轮
+	if n := len(s.Iterations); n > 1 {
+		first, last := s.Iterations[0].averageLatency(), s.Iterations[n-1].averageLatency()
+		if first > 0 && last > 0 {
+			LogPrintln("[T]", L("应答时间："), fmt.Sprintf(L("第1轮 %s ，第 %d 轮 %s"), millis(first), n, millis(last)),
+				fmt.Sprintf(L("，变化 %+.1f%%"), float64(last-first)*100/float64(first)))
+		}
+	}
+
+	// 每个测试第一次不通过的轮次
+	LogPrintln("[T]", "-----------------------------------------------------------------------------------------------")
+	firstFailure := 0
+	if len(s.Iterations) > 0 {
+		for i, v := range s.Iterations[0].Suite.Items {
+			if v.Interface == "" {
+				continue
+			}
+			first, failed, run := 0, 0, 0
+			for _, it := range s.Iterations {
+				verdict := it.Suite.Items[i].Verdict
+				if verdict == VerdictNone {
+					continue
+				}
+				run++
+				if !verdict.Passed() {
+					failed++
+					if first == 0 {
+						first = it.Index
+					}
+				}
+			}
+			if failed > 0 {
+				LogPrintln("[T]", L("首次失败："), FW(v.Name, 34), fmt.Sprintf(L("第 %d 轮，不通过 %d / %d 轮"), first, failed, run))
+				if firstFailure == 0 || first < firstFailure {
+					firstFailure = first
+				}
+			}
+		}
+	}
+	if firstFailure > 0 {
+		LogPrintln("[T]", L("测试结论："), fmt.Sprintf(L("从第 %d 轮开始出现不通过的测试"), firstFailure))
+	} else {
+		LogPrintln("[T]", L("测试结论："), L("全部轮次通过"))
+	}
+	LogPrintln("[T]", "===============================================================================================")
+}
+
+// ExitCode 根据所有轮次的测试结论计算进程退出码
+func (s *Soak) ExitCode(interrupted string) int {
+	if len(s.Iterations) == 0 {
+		if interrupted != "" {
+			return ExitInterrupted
+		}
+		return ExitError
+	}
+	var all TestQueue
+	for _, it := range s.Iterations {
+		all = append(all, it.Suite.Items...)
+	}
+	return ExitCode(all, interrupted)
+}
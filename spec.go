@@ -0,0 +1,76 @@
+package main
+
+// 《中国电信家庭终端与智能家庭网关自动连接的接口技术要求》(Q/CT2621-2017)中的消息类型
+var MessageTypes = []string{
+	"keyngreq",
+	"keyngack",
+	"dh",
+	"dev_reg",
+	"ack",
+	"keepalive",
+	"get_status",
+	"status",
+	"cfg",
+	"dev_report",
+	"getrssiinfo",
+	"deassociation",
+	"roaming_report",
+}
+
+// get_status消息可以查询的信息名称
+var GetStatusNames = []string{
+	"wifi",
+	"wifiswitch",
+	"ledswitch",
+	"wpsswitch",
+	"wifitimer",
+	"bandsupport",
+	"cpurate",
+	"memoryuserate",
+	"uploadspeed",
+	"downloadspeed",
+	"wlanstats",
+	"channel",
+	"onlineTime",
+	"terminalNum",
+	"load",
+	"real_devinfo",
+	"elinkstat",
+	"neighborinfo",
+	"networktype",
+	"workmode",
+}
+
+// SpecTable 是规范中的一个消息表和它包含的项目。项目的写法：
+// 消息类型如“dev_report”，cfg配置项如“cfg:wifi”，get_status查询名称如“get_status:cpurate”
+type SpecTable struct {
+	Table string   `json:"table"`
+	Title string   `json:"title"`
+	Items []string `json:"items"`
+}
+
+// SpecTables 是覆盖率统计使用的规范目录，可以用-spec指定的JSON文件替换。
+// 密钥协商、注册和心跳消息在每次连接时都会交互，不在目录中
+var SpecTables = []SpecTable{
+	{"表8", "配置与同步信息", []string{"cfg:wifi", "get_status:wifi"}},
+	{"表9", "配置信息", []string{"cfg:wifiswitch", "cfg:ledswitch", "cfg:wifitimer"}},
+	{"表10", "查询信息", specGetStatusItems()},
+	{"表12", "下挂设备状态信息", []string{"dev_report"}},
+	{"表14", "WPS开关消息", []string{"cfg:wpsswitch"}},
+	{"表15", "设备升级消息", []string{"cfg:upgrade"}},
+	{"表17", "设备操作信息", []string{"cfg:ctrlcommand"}},
+	{"表18", "漫游配置", []string{"cfg:roaming_set"}},
+	{"表19", "终端RSSI上报", []string{"roaming_report"}},
+	{"表20", "下挂终端去关联", []string{"deassociation"}},
+	{"表21", "无线信号检测", []string{"getrssiinfo"}},
+	{"表22", "信息返回", []string{"getrssiinfo"}},
+}
+
+func specGetStatusItems() (items []string) {
+	for _, v := range GetStatusNames {
+		if v != "wifi" {
+			items = append(items, "get_status:"+v)
+		}
+	}
+	return
+}
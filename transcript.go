@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 消息记录的方向，与日志中的[O]、[I]相同
+const (
+	TranscriptSent     = "O"
+	TranscriptReceived = "I"
+)
+
+// TranscriptEntry 是测试记录中的一条解密后的消息，Matched表示这条消息满足了应答关键词
+type TranscriptEntry struct {
+	Time    time.Time `json:"time"`
+	Dir     string    `json:"dir"`
+	Message string    `json:"message"`
+	Matched bool      `json:"matched,omitempty"`
+}
+
+// recordSent 开始新的测试记录，记录t时写入连接的请求
+func (q *TestItem) recordSent(t time.Time) {
+	msg, _ := json.Marshal(q.Request)
+	q.Transcript = []TranscriptEntry{{Time: t, Dir: TranscriptSent, Message: string(msg)}}
+}
+
+// recordReceived 记录等待应答期间收到的消息
+func (q *TestItem) recordReceived(msg string, matched bool) {
+	q.Transcript = append(q.Transcript, TranscriptEntry{Time: time.Now(), Dir: TranscriptReceived, Message: msg, Matched: matched})
+}
+
+// ReceivedCount 返回最后一次执行时收到的消息数
+func (q *TestItem) ReceivedCount() int {
+	count := 0
+	for _, v := range q.Transcript {
+		if v.Dir == TranscriptReceived {
+			count++
+		}
+	}
+	return count
+}
+
+// TranscriptText 把动作输出和测试记录整理成文本，每条消息一行
+func (q *TestItem) TranscriptText() string {
+	var b strings.Builder
+	if q.ActionResult != nil {
+		fmt.Fprintln(&b, fmt.Sprintf(L("动作: %s 退出码 %d"), q.ActionResult.Command, q.ActionResult.ExitCode))
+		if q.ActionResult.Output != "" {
+			fmt.Fprintln(&b, strings.TrimRight(q.ActionResult.Output, "\r\n"))
+		}
+	}
+	for _, v := range q.Transcript {
+		fmt.Fprintln(&b, v.Time.Format("15:04:05.000"), v.Arrow(), v.Message)
+	}
+	return b.String()
+}
+
+// Arrow 返回文本记录中表示方向的符号，满足应答关键词的消息加*标记
+func (e TranscriptEntry) Arrow() string {
+	switch {
+	case e.Dir == TranscriptSent:
+		return ">>>"
+	case e.Matched:
+		return "<<*"
+	}
+	return "<<<"
+}
+
+// Title 返回消息在报告中的说明
+func (e TranscriptEntry) Title() string {
+	switch {
+	case e.Dir == TranscriptSent:
+		return L("发送请求")
+	case e.Matched:
+		return L("收到消息（匹配应答关键词）")
+	}
+	return L("收到消息")
+}
+
+// failureMessage 说明测试不通过的原因：动作失败、没有收到消息或者没有匹配的关键词
+func failureMessage(q *TestItem) string {
+	if q.ActionResult != nil && q.ActionResult.ExitCode != 0 {
+		return fmt.Sprintf(L("动作执行失败，退出码 %d: %s"), q.ActionResult.ExitCode, q.ActionResult.Command)
+	}
+	if len(q.Transcript) == 0 {
+		return L("没有发送请求，准备步骤失败或者没有执行记录")
+	}
+	received := q.ReceivedCount()
+	if received == 0 {
+		return fmt.Sprintf(L("%d 秒内没有收到消息"), q.RecTimeOut)
+	}
+	var unmatched []string
+	for _, v := range q.Assertions {
+		if !v.Matched {
+			unmatched = append(unmatched, v.Keyword)
+		}
+	}
+	if len(unmatched) > 0 {
+		return fmt.Sprintf(L("收到 %d 条消息，没有匹配的关键词: %s"), received, strings.Join(unmatched, ", "))
+	}
+	return fmt.Sprintf(L("收到 %d 条消息，没有一条同时包含全部关键词: %s"), received, strings.Join(q.ResponseKeyWord, ", "))
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// 全屏界面保留的日志行数
+const tuiLogLines = 1000
+
+// 终端控制序列
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiReverse = "\x1b[7m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiCyan    = "\x1b[36m"
+	ansiGray    = "\x1b[90m"
+)
+
+var verdictColors = map[Verdict]string{
+	VerdictPass:           ansiGreen,
+	VerdictPassAfterRetry: ansiGreen,
+	VerdictFail:           ansiRed,
+	VerdictXPass:          ansiRed,
+	VerdictXFail:          ansiGray,
+	VerdictSkip:           ansiGray,
+}
+
+// DHCP服务的日志自带颜色，保存前去掉
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+var logColors = map[string]string{
+	"[I]": ansiCyan,
+	"[O]": ansiYellow,
+	"[E]": ansiRed,
+	"[W]": ansiRed,
+}
+
+// TUI 是测试执行时的全屏界面，分为测试队列、当前测试、设备信息和消息日志四个区域。
+// 日志通过SetLogOutput写入日志区域，回车键确认人工步骤，q或Ctrl+C停止测试
+type TUI struct {
+	cli    *Client
+	runner *Runner
+	suite  *TestSuite
+	start  time.Time
+
+	locker  sync.Mutex
+	lines   []string
+	partial bytes.Buffer
+	closed  bool
+	stops   int
+
+	fd        int
+	state     *term.State
+	logOutput io.Writer
+	done      chan struct{}
+}
+
+func NewTUI(cli *Client, runner *Runner, suite *TestSuite) *TUI {
+	return &TUI{
+		cli:    cli,
+		runner: runner,
+		suite:  suite,
+		start:  time.Now(),
+		fd:     int(os.Stdin.Fd()),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start 切换到全屏界面，标准输入输出不是终端时返回错误
+func (t *TUI) Start() error {
+	if !term.IsTerminal(t.fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New(L("标准输入输出不是终端"))
+	}
+	state, err := term.MakeRaw(t.fd)
+	if err != nil {
+		return err
+	}
+	t.state = state
+
+	// 日志、人工提示和DHCP服务的输出都转到界面中
+	t.logOutput = SetLogOutput(t)
+	PromptWriter = ioutil.Discard
+	PromptStdin = false
+	PromptRemote = true
+
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	go t.readKeys()
+	go t.refresh()
+	return nil
+}
+
+// Close 恢复终端，可以多次调用，t为nil时什么都不做
+func (t *TUI) Close() {
+	if t == nil {
+		return
+	}
+	t.locker.Lock()
+	if t.closed {
+		t.locker.Unlock()
+		return
+	}
+	t.closed = true
+	close(t.done)
+
+	fmt.Print("\x1b[?25h\x1b[?1049l")
+	term.Restore(t.fd, t.state)
+	PromptWriter = os.Stdout
+	PromptStdin = true
+	t.locker.Unlock()
+
+	// 日志输出时先锁定日志再锁定界面，恢复日志输出不能在锁定界面时进行
+	SetLogOutput(t.logOutput)
+}
+
+// Write 把日志按行保存到日志区域
+func (t *TUI) Write(p []byte) (int, error) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	if t.closed {
+		return os.Stdout.Write(p)
+	}
+
+	t.partial.Write(p)
+	for {
+		line, err := t.partial.ReadString('\n')
+		if err != nil {
+			// 没有换行的部分留到下次
+			t.partial.WriteString(line)
+			break
+		}
+		t.lines = append(t.lines, ansiEscape.ReplaceAllString(strings.TrimRight(line, "\r\n"), ""))
+	}
+	if len(t.lines) > tuiLogLines {
+		t.lines = append([]string(nil), t.lines[len(t.lines)-tuiLogLines:]...)
+	}
+	return len(p), nil
+}
+
+func (t *TUI) readKeys() {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case <-t.done:
+			return
+		default:
+		}
+		for _, b := range buf[:n] {
+			switch b {
+			case '\r', '\n':
+				ConfirmPrompt()
+			case 'q', 'Q', 3:
+				t.stop()
+			}
+		}
+	}
+}
+
+// stop 第一次按键时停止测试，再次按键时立即退出
+func (t *TUI) stop() {
+	t.locker.Lock()
+	t.stops++
+	stops := t.stops
+	t.locker.Unlock()
+
+	if stops == 1 {
+		LogPrintln("[W]", L("收到停止按键，停止测试，再次按q立即退出"))
+		t.runner.Stop(L("收到停止按键"))
+		return
+	}
+	t.Close()
+	LogPrintln("[E]", L("再次收到停止按键，立即退出"))
+	os.Exit(ExitInterrupted)
+}
+
+func (t *TUI) refresh() {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		t.draw()
+		select {
+		case <-ticker.C:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *TUI) draw() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return
+	}
+	if width < 60 || height < 20 {
+		t.locker.Lock()
+		if !t.closed {
+			fmt.Print("\x1b[H\x1b[2J" + L("终端窗口太小，至少需要60列20行"))
+		}
+		t.locker.Unlock()
+		return
+	}
+
+	// 左侧为测试队列和设备信息，右侧为当前测试和消息日志
+	leftWidth := width * 2 / 5
+	rightWidth := width - leftWidth - 1
+	bodyHeight := height - 2
+	deviceHeight := 9
+	currentHeight := 7
+
+	left := append(t.queuePane(leftWidth, bodyHeight-deviceHeight), t.devicePane(leftWidth, deviceHeight)...)
+	right := append(t.currentPane(rightWidth, currentHeight), t.logPane(rightWidth, bodyHeight-currentHeight)...)
+
+	var screen bytes.Buffer
+	screen.WriteString("\x1b[H")
+	title := fmt.Sprintf(L(" e-Link 自组网接口一致性测试  %s  已用时 %v"), t.summary(),
+		time.Since(t.start).Truncate(time.Second))
+	screen.WriteString(ansiReverse + FWClip(title, width) + ansiReset + "\r\n")
+	for i := 0; i < bodyHeight; i++ {
+		screen.WriteString(left[i] + ansiGray + "│" + ansiReset + right[i] + "\r\n")
+	}
+	help := L(" Enter 确认人工步骤   q/Ctrl+C 停止测试，再按一次立即退出")
+	if reason := t.runner.Interrupted(); reason != "" {
+		help = L(" 正在停止: ") + reason
+	}
+	screen.WriteString(ansiReverse + FWClip(help, width) + ansiReset)
+
+	t.locker.Lock()
+	if !t.closed {
+		os.Stdout.Write(screen.Bytes())
+	}
+	t.locker.Unlock()
+}
+
+// paneTitle 返回区域标题行
+func paneTitle(title string, width int) string {
+	return ansiBold + FWClip("── "+title+" "+strings.Repeat("─", width), width) + ansiReset
+}
+
+func (t *TUI) queuePane(width, height int) []string {
+	items := t.suite.Items
+	current := t.runner.Current()
+
+	// 让正在执行的测试，或者第一个未执行的测试，显示在区域中间
+	focus := -1
+	for i, v := range items {
+		if v == current || (current == nil && t.runner.Verdict(v) == VerdictNone) {
+			focus = i
+			break
+		}
+	}
+	done := 0
+	for _, v := range items {
+		if t.runner.Verdict(v) != VerdictNone {
+			done++
+		}
+	}
+
+	rows := height - 1
+	offset := 0
+	if focus >= 0 {
+		offset = focus - rows/2
+	}
+	if offset > len(items)-rows {
+		offset = len(items) - rows
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	pane := []string{paneTitle(fmt.Sprintf(L("测试队列 %d/%d"), done, len(items)), width)}
+	for i := offset; i < len(items) && len(pane) < height; i++ {
+		v := items[i]
+		verdict := t.runner.Verdict(v)
+		status, color := verdict.String(), verdictColors[verdict]
+		if v == current {
+			status, color = L("执行中"), ansiYellow+ansiBold
+		}
+		name := FWClip(fmt.Sprintf("%4d %s", i+1, v.Name), width-13)
+		pane = append(pane, name+" "+color+FW(status, 12)+ansiReset)
+	}
+	return fillPane(pane, width, height)
+}
+
+func (t *TUI) currentPane(width, height int) []string {
+	pane := []string{paneTitle(L("当前测试"), width)}
+	q := t.runner.Current()
+	switch {
+	case q != nil:
+		pane = append(pane,
+			FWClip(L("测试名称: ")+q.Name, width),
+			FWClip(L("接口名称: ")+q.Interface, width),
+			FWClip(fmt.Sprintf(L("词语匹配: %v  超时时间: %d 秒  重试次数: %d"), q.ResponseKeyWord, q.RecTimeOut, q.Retries), width))
+		if q.Action != "" {
+			pane = append(pane, FWClip(L("执行动作: ")+q.Action, width))
+		} else if q.MessageBox != "" {
+			pane = append(pane, FWClip(L("人工步骤: ")+q.MessageBox, width))
+		}
+		if prompt := PendingPrompt(); prompt != "" {
+			line := L("等待确认，按回车键继续")
+			if deadline := PendingPromptDeadline(); !deadline.IsZero() {
+				line += fmt.Sprintf(L("  剩余 %d 秒"), secondsLeft(deadline))
+			}
+			pane = append(pane, ansiYellow+ansiBold+FWClip(line, width)+ansiReset)
+		} else if deadline := t.runner.Deadline(); !deadline.IsZero() {
+			pane = append(pane, ansiCyan+FWClip(fmt.Sprintf(L("等待应答: 剩余 %d 秒"), secondsLeft(deadline)), width)+ansiReset)
+		}
+	case t.cli.State() != StateELKConnected:
+		pane = append(pane, FWClip(L("等待设备连接并完成注册..."), width))
+	default:
+		pane = append(pane, FWClip(L("没有正在执行的测试"), width))
+	}
+	return fillPane(pane, width, height)
+}
+
+// summary 统计各种测试结论的数量，结论由执行测试的goroutine修改，要通过runner读取
+func (t *TUI) summary() string {
+	var queue TestQueue
+	for _, v := range t.suite.Items.Reported() {
+		queue = append(queue, &TestItem{Verdict: t.runner.Verdict(v)})
+	}
+	return queue.Summary()
+}
+
+func (t *TUI) devicePane(width, height int) []string {
+	info := t.cli.Info()
+	pane := []string{
+		paneTitle(L("设备信息"), width),
+		FWClip(fmt.Sprintf(L("连接状态: %s  连接次数: %d"), L(stateNames[t.cli.State()]), t.cli.ConnTimes()), width),
+		FWClip("MAC:      "+info.MAC, width),
+		FWClip(L("厂商型号: ")+info.Vendor+" "+info.Model, width),
+		FWClip(L("软件版本: ")+info.SWVersion, width),
+		FWClip(L("硬件版本: ")+info.HDVersion, width),
+		FWClip(L("序 列 号: ")+info.SN, width),
+		FWClip(L("IP地址:   ")+info.IPAddr, width),
+	}
+	return fillPane(pane, width, height)
+}
+
+func (t *TUI) logPane(width, height int) []string {
+	t.locker.Lock()
+	lines := t.lines
+	if len(lines) > height-1 {
+		lines = lines[len(lines)-(height-1):]
+	}
+	lines = append([]string(nil), lines...)
+	t.locker.Unlock()
+
+	pane := []string{paneTitle(L("消息日志"), width)}
+	for _, line := range lines {
+		// 去掉日期只保留时间
+		if len(line) > 20 && line[4] == '-' {
+			line = line[11:]
+		}
+		line = strings.Replace(line, "\t", " ", -1)
+		color := ""
+		if fields := strings.SplitN(line, " ", 3); len(fields) > 1 {
+			color = logColors[fields[1]]
+		}
+		pane = append(pane, color+FWClip(line, width)+ansiReset)
+	}
+	return fillPane(pane, width, height)
+}
+
+// fillPane 用空行把区域补足height行
+func fillPane(pane []string, width, height int) []string {
+	for len(pane) < height {
+		pane = append(pane, strings.Repeat(" ", width))
+	}
+	return pane[:height]
+}
+
+func secondsLeft(deadline time.Time) int {
+	left := int(time.Until(deadline).Seconds() + 0.5)
+	if left < 0 {
+		left = 0
+	}
+	return left
+}
@@ -5,54 +5,9 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/base64"
-	"fmt"
 	"math/big"
-	"time"
 )
 
-var LogQuiet = false
-var LogQuietDump = ""
-
-func LogEnable(enable bool) {
-	if enable {
-		LogQuiet = false
-		if LogQuietDump != "" {
-			fmt.Print(LogQuietDump)
-			LogQuietDump = ""
-		}
-	} else {
-		LogQuiet = true
-		LogQuietDump = ""
-	}
-}
-
-func LogPrintln(a ...interface{}) {
-	var buf bytes.Buffer
-	for argNum, arg := range a {
-		if argNum > 0 {
-			buf.WriteByte(' ')
-		}
-		buf.WriteString(fmt.Sprint(arg))
-	}
-
-	if LogQuiet {
-		LogQuietDump += fmt.Sprintln(time.Now().Format("2006-01-02 15:04:05"), buf.String())
-	} else {
-		fmt.Println(time.Now().Format("2006-01-02 15:04:05"), buf.String())
-	}
-}
-
-func LogPrintf(format string, a ...interface{}) {
-	var buf bytes.Buffer
-	buf.WriteString(fmt.Sprintf(format, a...))
-
-	if LogQuiet {
-		LogQuietDump += fmt.Sprintln(time.Now().Format("2006-01-02 15:04:05"), buf.String())
-	} else {
-		fmt.Print(time.Now().Format("2006-01-02 15:04:05"), buf.String())
-	}
-}
-
 // Returns the appropriate base-two padded
 // bytes (assuming the underlying big representation remains b2c)
 func BigBytes(i *big.Int) (buff []byte) {
@@ -192,3 +147,19 @@ func FW(s string, l int) string {
 
 	return s
 }
+
+// FWClip 把字符串截断到不超过l列并补齐空格，全角字符占两列
+func FWClip(s string, l int) string {
+	w := 0
+	for i, c := range s {
+		cw := 1
+		if IsFullwidth(c) {
+			cw = 2
+		}
+		if w+cw > l {
+			return FW(s[:i], l)
+		}
+		w += cw
+	}
+	return FW(s, l)
+}